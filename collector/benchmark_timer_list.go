@@ -0,0 +1,109 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("benchmark.timer_list", defaultEnabled, NewBenchmarkTimerListCollector)
+}
+
+// benchmark timer values, by key in the timer_list reply
+var benchmarkTimerStats = map[string]string{
+	"last_sum":     "last_sum",
+	"last_max":     "last_max",
+	"last_min":     "last_min",
+	"period_sum":   "period_sum",
+	"period_max":   "period_max",
+	"period_min":   "period_min",
+	"period_media": "period_avg",
+	"global_max":   "global_max",
+	"global_min":   "global_min",
+}
+
+type benchmarkTimerListCollector struct {
+	timer  *prometheus.Desc
+	calls  *prometheus.Desc
+	logger log.Logger
+	config *KamailioCollectorConfig
+}
+
+// NewBenchmarkTimerListCollector returns a new Collector exposing benchmark timers.
+func NewBenchmarkTimerListCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &benchmarkTimerListCollector{
+		timer: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "benchmark", "timer"),
+			"Benchmark timer values, in the unit of the benchmark module clock",
+			[]string{"timer", "stat"}, nil),
+		calls: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "benchmark", "timer_calls_total"),
+			"Number of calls of the benchmark timer",
+			[]string{"timer"}, nil),
+		logger: logger,
+		config: config,
+	}, nil
+}
+
+func (c *benchmarkTimerListCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.timer
+	ch <- c.calls
+}
+
+func (c *benchmarkTimerListCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, "benchmark.timer_list")
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		items, _ := record.StructItems()
+		var name string
+		for _, item := range items {
+			if item.Key == "name" {
+				name, _ = item.Value.String()
+			}
+		}
+		if name == "" {
+			continue
+		}
+		for _, item := range items {
+			value, ok := recordNumber(item.Value)
+			if !ok {
+				continue
+			}
+			if item.Key == "calls" {
+				metricChannel <- prometheus.MustNewConstMetric(c.calls, prometheus.CounterValue, value, name)
+				continue
+			}
+			if stat, ok := benchmarkTimerStats[item.Key]; ok {
+				metricChannel <- prometheus.MustNewConstMetric(c.timer, prometheus.GaugeValue, value, name, stat)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// binrpcConn keeps the connection to Kamailio open between scrapes,
+// unless reconnect is set. It must be locked while in use.
+type binrpcConn struct {
+	sync.Mutex
+	network   string
+	address   string
+	reconnect bool
+	// wraps the TCP connection when set
+	tlsConfig *tls.Config
+	conn      net.Conn
+}
+
+func newBinrpcConn(url *url.URL, reconnect bool, tlsConfig *tls.Config) *binrpcConn {
+	// url.Host keeps an unbracketed IPv6 literal as is, which can't be dialed
+	address := net.JoinHostPort(url.Hostname(), url.Port())
+	if url.Scheme == "unix" {
+		address = url.Path
+	}
+	if tlsConfig != nil && tlsConfig.ServerName == "" {
+		// verify the certificate against the host of the URI
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = url.Hostname()
+	}
+	return &binrpcConn{network: url.Scheme, address: address, reconnect: reconnect, tlsConfig: tlsConfig}
+}
+
+// transport names the transport in kamailio_exporter_transport_info.
+func (c *binrpcConn) transport() string {
+	if c.tlsConfig != nil {
+		return "tls"
+	}
+	return c.network
+}
+
+// dial opens a connection, and completes the TLS handshake if enabled.
+func (c *binrpcConn) dial(deadline time.Time) (net.Conn, error) {
+	conn, err := net.DialTimeout(c.network, c.address, time.Until(deadline))
+	if err != nil || c.tlsConfig == nil {
+		return conn, err
+	}
+	tlsConn := tls.Client(conn, c.tlsConfig)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with %s failed: %w", c.address, err)
+	}
+	return tlsConn, nil
+}
+
+// get returns the open connection, or dials a new one, with the deadline
+// of a scrape. reused tells whether the connection was opened by a
+// previous scrape, and might have been closed by Kamailio since.
+func (c *binrpcConn) get(deadline time.Time) (conn net.Conn, reused bool, err error) {
+	if c.conn == nil {
+		c.conn, err = c.dial(deadline)
+		if err != nil {
+			c.conn = nil
+			return nil, false, err
+		}
+	} else {
+		reused = true
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		c.close()
+		return nil, false, err
+	}
+	return c.conn, reused, nil
+}
+
+// close closes the connection, the next call to get dials a new one.
+func (c *binrpcConn) close() {
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+}
+
+// release ends a scrape. A broken connection can't be trusted to be in
+// sync with Kamailio anymore, e.g. after a timeout, and is closed.
+func (c *binrpcConn) release(broken bool) {
+	if broken || c.reconnect {
+		c.close()
+	}
+}
+
+// first delay before retrying a command after a connection error
+const retryBackoff = 100 * time.Millisecond
+
+// scrapeConn is the connection given to the collectors during a scrape.
+// It can be re-dialed when Kamailio closes it, e.g. during a reload.
+type scrapeConn struct {
+	net.Conn
+	c          *binrpcConn
+	deadline   time.Time
+	maxRetries int
+	// observe the durations and count the faults of the commands, when not nil
+	rpcDuration prometheus.ObserverVec
+	rpcFaults   *prometheus.CounterVec
+	// faults worth retrying
+	retryableFaultCodes []int
+}
+
+// redial replaces the connection with a new one, keeping the scrape deadline.
+func (sc *scrapeConn) redial() error {
+	sc.c.close()
+	conn, _, err := sc.c.get(sc.deadline)
+	if err != nil {
+		return err
+	}
+	sc.Conn = conn
+	return nil
+}
+
+// isTransientError tells whether a command may succeed on a new connection.
+// After a timeout, the deadline of the scrape is over anyway.
+func isTransientError(err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	return isConnectionError(err)
+}
+
+// isConnectionError tells whether the connection failed, e.g. timed out or
+// closed by Kamailio, rather than the command.
+func isConnectionError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// newTLSConfig returns the TLS configuration of the BINRPC connection, or nil
+// when TLS isn't enabled.
+func newTLSConfig(config TLSConfig) (*tls.Config, error) {
+	if config.Enabled == nil || !*config.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.CAFile != nil && *config.CAFile != "" {
+		pem, err := os.ReadFile(*config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the TLS CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the TLS CA file %s", *config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	certFile, keyFile := "", ""
+	if config.CertFile != nil {
+		certFile = *config.CertFile
+	}
+	if config.KeyFile != nil {
+		keyFile = *config.KeyFile
+	}
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("the TLS certificate and key files must be given together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load the TLS client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if config.ServerName != nil {
+		tlsConfig.ServerName = *config.ServerName
+	}
+	if config.InsecureSkipVerify != nil {
+		tlsConfig.InsecureSkipVerify = *config.InsecureSkipVerify
+	}
+	return tlsConfig, nil
+}
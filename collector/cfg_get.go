@@ -0,0 +1,168 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerConfiguredCollector("cfg.get", func(config *KamailioCollectorConfig) bool {
+		return hasListValue(config.Cfg.Params)
+	}, NewCfgGetCollector)
+}
+
+// this is used to validate the "group.name" configuration parameters
+var cfgParamRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*\.[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+type cfgParam struct {
+	group string
+	name  string
+	desc  *prometheus.Desc
+}
+
+type cfgGetCollector struct {
+	params []cfgParam
+	logger log.Logger
+	config *KamailioCollectorConfig
+	// the parameters are read at the first scrape and after each restart of
+	// Kamailio, seen from its uptime going back
+	mtx    sync.Mutex
+	values map[string]float64
+	uptime int
+}
+
+// NewCfgGetCollector returns a new Collector exposing configuration parameters.
+func NewCfgGetCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	params := make([]cfgParam, 0)
+	if config.Cfg.Params != nil {
+		for _, value := range *config.Cfg.Params {
+			for _, param := range strings.Split(value, ",") {
+				if param == "" {
+					continue
+				}
+				if !cfgParamRegex.MatchString(param) {
+					return nil, fmt.Errorf("invalid configuration parameter %q, expected GROUP.NAME", param)
+				}
+				entry := strings.SplitN(param, ".", 2)
+				params = append(params, cfgParam{
+					group: entry[0],
+					name:  entry[1],
+					desc: prometheus.NewDesc(
+						prometheus.BuildFQName(namespace, "config", entry[0]+"_"+entry[1]),
+						"Configuration parameter "+param,
+						[]string{}, nil),
+				})
+			}
+		}
+	}
+	return &cfgGetCollector{
+		params: params,
+		logger: logger,
+		config: config,
+		uptime: -1,
+	}, nil
+}
+
+func (c *cfgGetCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, p := range c.params {
+		ch <- p.desc
+	}
+}
+
+func (c *cfgGetCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	uptime, err := coreUptime(conn, c.logger)
+	if err != nil {
+		return err
+	}
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.values == nil || uptime < c.uptime {
+		values, err := c.read(conn)
+		if err != nil {
+			return err
+		}
+		c.values = values
+	}
+	c.uptime = uptime
+
+	for _, p := range c.params {
+		if v, ok := c.values[p.group+"."+p.name]; ok {
+			metricChannel <- prometheus.MustNewConstMetric(p.desc, prometheus.GaugeValue, v)
+		}
+	}
+	return nil
+}
+
+// read returns the numeric values of the parameters, by GROUP.NAME. A fault,
+// e.g. for a parameter missing from this build, only skips the parameter.
+func (c *cfgGetCollector) read(conn net.Conn) (map[string]float64, error) {
+	values := make(map[string]float64)
+	for _, p := range c.params {
+		records, err := getRecords(conn, c.logger, "cfg.get", p.group, p.name)
+		if err != nil {
+			if _, isFault := faultCode(err); isFault {
+				level.Warn(c.logger).Log("msg", "Skipping the configuration parameter", "group", p.group, "name", p.name, "err", err)
+				continue
+			}
+			return nil, err
+		}
+		if len(records) == 0 {
+			continue
+		}
+		v, err := records[0].Int()
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "Configuration parameter is not a number", "group", p.group, "name", p.name)
+			continue
+		}
+		values[p.group+"."+p.name] = float64(v)
+	}
+	return values, nil
+}
+
+// coreUptime returns the uptime of Kamailio in seconds, as exported by the
+// core.runinfo collector.
+func coreUptime(conn net.Conn, logger log.Logger) (int, error) {
+	records, err := getRecords(conn, logger, "core.runinfo")
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, ErrNoData
+	}
+	items, _ := records[0].StructItems()
+	for _, item := range items {
+		if item.Key == "uptime_secs" {
+			return item.Value.Int()
+		}
+	}
+	return 0, ErrNoData
+}
@@ -0,0 +1,76 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestCfgGetCache(t *testing.T) {
+	uptime, maxConnections := 100, 2048
+	k := newFakeKamailio(func(args []string) fakeReply {
+		switch {
+		case args[0] == "core.runinfo":
+			return binrpcReply(binrpcStruct(map[string][]byte{"uptime_secs": binrpcInt(uptime)}))
+		case slices.Equal(args, []string{"cfg.get", "tcp", "max_connections"}):
+			return binrpcReply(binrpcInt(maxConnections))
+		}
+		return binrpcFault(500, "Error while getting the param")
+	})
+	params := []string{"tcp.max_connections,tcp.typo"}
+	c, err := NewCfgGetCollector(&KamailioCollectorConfig{Cfg: CfgConfig{Params: &params}}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewCfgGetCollector: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		uptime   int
+		value    int
+		commands []string
+		want     float64
+	}{
+		// the fault of tcp.typo doesn't drop tcp.max_connections
+		{"first scrape", 100, 2048, []string{"core.runinfo", "cfg.get", "cfg.get"}, 2048},
+		{"cached", 110, 4096, []string{"core.runinfo"}, 2048},
+		{"restart", 5, 4096, []string{"core.runinfo", "cfg.get", "cfg.get"}, 4096},
+	}
+	sent := 0
+	for _, test := range tests {
+		uptime, maxConnections = test.uptime, test.value
+		metrics, err := collectSubCollector(t, c, k)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		commands := k.commands()
+		if got := commands[sent:]; !slices.Equal(got, test.commands) {
+			t.Errorf("%s: sent %v, want %v", test.name, got, test.commands)
+		}
+		sent = len(commands)
+		if len(metrics) != 1 || metrics[0].GetGauge().GetValue() != test.want {
+			t.Errorf("%s: got %v, want tcp.max_connections %v", test.name, metrics, test.want)
+		}
+	}
+}
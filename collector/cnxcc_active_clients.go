@@ -0,0 +1,109 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("cnxcc.active_clients", defaultEnabled, NewCnxccActiveClientsCollector)
+}
+
+// names of the credit types of cnxcc
+var cnxccCreditTypes = map[string]string{
+	"0": "time",
+	"1": "money",
+	"2": "channel",
+}
+
+type cnxccActiveClientsCollector struct {
+	clients  *prometheus.Desc
+	sessions *prometheus.Desc
+	logger   log.Logger
+	config   *KamailioCollectorConfig
+}
+
+// NewCnxccActiveClientsCollector returns a new Collector exposing the clients and calls under credit control.
+func NewCnxccActiveClientsCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &cnxccActiveClientsCollector{
+		clients: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cnxcc", "active_clients"),
+			"Clients with calls under credit control, by credit type",
+			[]string{"type"}, nil),
+		sessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "cnxcc", "active_sessions"),
+			"Concurrent calls under credit control, by credit type",
+			[]string{"type"}, nil),
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (c *cnxccActiveClientsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.clients
+	ch <- c.sessions
+}
+
+func (c *cnxccActiveClientsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, "cnxcc.active_clients")
+	if err != nil {
+		return err
+	}
+
+	clients := map[string]int{"time": 0, "money": 0, "channel": 0}
+	sessions := map[string]int{"time": 0, "money": 0, "channel": 0}
+	for _, record := range records {
+		// the reply is a single string of rows separated by ";", e.g.
+		// "client_id:alice,number_of_calls:1,concurrent_calls:1,type:1,max_amount:10.000000,consumed_amount:0.100000;"
+		reply, _ := record.String()
+		for _, row := range strings.Split(reply, ";") {
+			fields := make(map[string]string)
+			for _, field := range strings.Split(row, ",") {
+				if key, value, ok := strings.Cut(strings.TrimSpace(field), ":"); ok {
+					fields[key] = value
+				}
+			}
+			if fields["client_id"] == "" {
+				continue
+			}
+			creditType, ok := cnxccCreditTypes[fields["type"]]
+			if !ok {
+				creditType = fields["type"]
+			}
+			clients[creditType]++
+			calls, _ := strconv.Atoi(fields["concurrent_calls"])
+			sessions[creditType] += calls
+		}
+	}
+	for creditType, count := range clients {
+		metricChannel <- prometheus.MustNewConstMetric(c.clients, prometheus.GaugeValue, float64(count), creditType)
+		metricChannel <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(sessions[creditType]), creditType)
+	}
+	return nil
+}
@@ -22,12 +22,18 @@
 package collector
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"net"
 	"net/url"
+	"regexp"
 	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/log"
@@ -36,80 +42,249 @@ import (
 	"go.angarium.io/kamailio/binrpc"
 )
 
-// Exporter namespace.
-const namespace = "kamailio"
+const defaultNamespace = "kamailio"
 
-var (
-	scrapeDurationDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "scrape", "collector_duration_seconds"),
-		"kamailio_exporter: Duration of a collector scrape.",
-		[]string{"collector"},
-		nil,
-	)
-	scrapeSuccessDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "scrape", "collector_success"),
-		"kamailio_exporter: Whether a collector succeeded.",
-		[]string{"collector"},
-		nil,
-	)
-	kamailioDialFailureDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "failure_total"),
-		"kamailio_exporter: Counter of a Dial failures.",
-		[]string{},
-		nil,
-	)
-	kamailioUpDesc = prometheus.NewDesc(
-		prometheus.BuildFQName(namespace, "", "up"),
-		"kamailio_exporter: Whether the Kamailio endpoint is up.",
-		[]string{},
-		nil,
-	)
-)
+// Exporter namespace, prefixing the name of every metric. It's the namespace
+// of the collector being created by NewKamailioCollector, which holds
+// initiatedCollectorsMtx meanwhile, for the factories to build their
+// descriptors.
+var namespace = defaultNamespace
 
-var (
-	dialErrorCounter = 0
-)
+// a namespace must be a valid metric name on its own
+var namespaceRegex = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// MetricNamespace returns the namespace prefixing the metric names of config,
+// for the factories to name the metrics of their collectors.
+func MetricNamespace(config *KamailioCollectorConfig) string {
+	if config.Namespace != nil && *config.Namespace != "" {
+		return *config.Namespace
+	}
+	return defaultNamespace
+}
+
+// exporterDescs are the descriptors of the exporter metrics, in the namespace
+// of a collector.
+type exporterDescs struct {
+	scrapeDuration      *prometheus.Desc
+	scrapeSuccess       *prometheus.Desc
+	scrapeTotalDuration *prometheus.Desc
+	dialFailure         *prometheus.Desc
+	up                  *prometheus.Desc
+	collectorEmpty      *prometheus.Desc
+	transportInfo       *prometheus.Desc
+	capability          *prometheus.Desc
+	scrapeAborted       *prometheus.Desc
+	startTime           *prometheus.Desc
+	config              *prometheus.Desc
+	throttled           *prometheus.Desc
+}
+
+func newExporterDescs(namespace string) *exporterDescs {
+	return &exporterDescs{
+		scrapeDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape", "collector_duration_seconds"),
+			"kamailio_exporter: Duration of a collector scrape.",
+			[]string{"collector"},
+			nil,
+		),
+		scrapeSuccess: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape", "collector_success"),
+			"kamailio_exporter: Whether a collector succeeded.",
+			[]string{"collector"},
+			nil,
+		),
+		scrapeTotalDuration: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "scrape", "duration_seconds"),
+			"kamailio_exporter: Duration of the whole scrape of Kamailio.",
+			[]string{},
+			nil,
+		),
+		dialFailure: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "failure_total"),
+			"kamailio_exporter: Counter of a Dial failures.",
+			[]string{},
+			nil,
+		),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "up"),
+			"kamailio_exporter: Whether the Kamailio endpoint is up.",
+			[]string{},
+			nil,
+		),
+		collectorEmpty: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "collector_empty"),
+			"kamailio_exporter: Whether a collector succeeded without returning any data.",
+			[]string{"collector"},
+			nil,
+		),
+		transportInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "transport_info"),
+			"kamailio_exporter: Transport used to reach Kamailio.",
+			[]string{"transport", "address"},
+			nil,
+		),
+		capability: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "capability"),
+			"kamailio_exporter: Whether the RPC command is available in Kamailio.",
+			[]string{"name"},
+			nil,
+		),
+		scrapeAborted: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "scrape_aborted"),
+			"kamailio_exporter: Collector whose connection error made the scrape skip the remaining collectors.",
+			[]string{"collector"},
+			nil,
+		),
+		startTime: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "start_time_seconds"),
+			"kamailio_exporter: Start time of the exporter since unix epoch in seconds.",
+			[]string{},
+			nil,
+		),
+		config: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "config"),
+			"kamailio_exporter: Effective value of a setting of the exporter.",
+			[]string{"key", "value"},
+			nil,
+		),
+		throttled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "throttled_scrapes_total"),
+			"kamailio_exporter: Scrapes answered with the previous result, because they came faster than the minimum scrape interval.",
+			[]string{},
+			nil,
+		),
+	}
+}
+
+var startTime = time.Now()
+
+// rpcDurationBuckets fits the round-trip of a local BINRPC socket.
+var rpcDurationBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
 
 const (
 	defaultEnabled  = true
 	defaultDisabled = false
 )
 
+// Factory builds a SubCollector from the exporter configuration.
+type Factory func(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error)
+
 var (
-	factories              = make(map[string]func(config *KamailioCollectorConfig, logger log.Logger) (Collector, error))
+	factories              = make(map[string]Factory)
 	initiatedCollectorsMtx = sync.Mutex{}
-	initiatedCollectors    = make(map[string]Collector)
+	initiatedCollectors    = make(map[string]SubCollector)
 	collectorStateGlobal   = make(map[string]bool)
-	availableCollectors    = make([]string, 0)
+	// tells whether the options of a collector are set, it doesn't run otherwise
+	collectorConfigured = make(map[string]func(config *KamailioCollectorConfig) bool)
+	availableCollectors = make([]string, 0)
 )
 
-func registerCollector(collector string, isDefaultEnabled bool, factory func(config *KamailioCollectorConfig, logger log.Logger) (Collector, error)) {
+func registerCollector(collector string, isDefaultEnabled bool, factory Factory) {
+	if _, ok := factories[collector]; ok {
+		panic(fmt.Sprintf("collector %q is already registered", collector))
+	}
 	availableCollectors = append(availableCollectors, collector)
 	collectorStateGlobal[collector] = isDefaultEnabled
 	factories[collector] = factory
 }
 
+// registerConfiguredCollector registers a collector which only runs when
+// configured tells its options are set, e.g. by its flag.
+func registerConfiguredCollector(collector string, configured func(config *KamailioCollectorConfig) bool, factory Factory) {
+	registerCollector(collector, defaultEnabled, factory)
+	collectorConfigured[collector] = configured
+}
+
+// hasListValue tells whether a repeatable, comma separated option has a value.
+func hasListValue(values *[]string) bool {
+	if values == nil {
+		return false
+	}
+	for _, value := range *values {
+		for _, entry := range strings.Split(value, ",") {
+			if strings.TrimSpace(entry) != "" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Register makes a collector available to NewKamailioCollector, the same way
+// as the built-in collectors. The collector name must be the BINRPC command it
+// runs, it is skipped when Kamailio doesn't provide that command.
+// Register must be called before NewKamailioCollector, usually from init.
+func Register(collector string, isDefaultEnabled bool, factory Factory) {
+	registerCollector(collector, isDefaultEnabled, factory)
+}
+
 // KamailioCollector implements the prometheus.Collector interface.
 type KamailioCollector struct {
-	Collectors map[string]Collector
+	Collectors map[string]SubCollector
 	timeout    time.Duration
-	url        *url.URL
 	logger     log.Logger
+	dialErrors *errorLimiter
+	guard      *scrapeGuard
+	conn       *binrpcConn
+	tlsConfig  *tls.Config
+	maxRetries int
+	counters   *counterTracker
+	descs      *exporterDescs
+	// fault codes retried by the commands
+	retryableFaultCodes []int
+	// failed connections to Kamailio
+	dialFailures *atomic.Int64
+	// durations and faults of the commands, nil for the probes
+	rpcDuration prometheus.ObserverVec
+	rpcFaults   *prometheus.CounterVec
+	// failed queries of the collectors, kept across the scrapes
+	scrapeErrors *prometheus.CounterVec
+	// effective settings, by key
+	settings map[string]string
+	// guards of the probed targets
+	probeGuards *probeGuards
+	// probes don't record the exporter health, the RPC durations nor the faults
+	probe bool
 }
 
 // NewKamailioCollector creates a new NodeCollector.
 func NewKamailioCollector(config *KamailioCollectorConfig, logger log.Logger) (*KamailioCollector, error) {
 	// fill the Collector struct
-	url, err := url.Parse(*config.BinrpcURI)
+	uri := DefaultBinrpcURI
+	if config.BinrpcURI != nil {
+		uri = *config.BinrpcURI
+	}
+	url, err := parseBinrpcURI(uri)
 	if err != nil {
-		return nil, fmt.Errorf("cannot parse URI: %w", err)
+		return nil, err
 	}
 
-	collectors := make(map[string]Collector)
-
+	// the collectors are built in the namespace of this one, one at a time
 	initiatedCollectorsMtx.Lock()
 	defer initiatedCollectorsMtx.Unlock()
-	for key, enabled := range collectorStateGlobal {
+	ns := MetricNamespace(config)
+	if !namespaceRegex.MatchString(ns) {
+		return nil, fmt.Errorf("invalid metric namespace %q: it must match %s", ns, namespaceRegex)
+	}
+	namespace = ns
+
+	rpcDuration, err := newRPCDuration(config)
+	if err != nil {
+		return nil, err
+	}
+	retryableFaultCodes, err := parseFaultCodes(config.RetryFaultCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	collectors := make(map[string]SubCollector)
+
+	states, err := collectorStates(config)
+	if err != nil {
+		return nil, err
+	}
+
+	for key, enabled := range states {
 		if !enabled {
 			continue
 		}
@@ -120,58 +295,362 @@ func NewKamailioCollector(config *KamailioCollectorConfig, logger log.Logger) (*
 		collectors[key] = collector
 		initiatedCollectors[key] = collector
 	}
-	return &KamailioCollector{Collectors: collectors, logger: logger, url: url, timeout: *config.Timeout}, nil
+	var minScrapeInterval time.Duration
+	if config.MinScrapeInterval != nil {
+		minScrapeInterval = *config.MinScrapeInterval
+	}
+	timestamps := TimestampsAuto
+	if config.MetricTimestamps != nil {
+		timestamps = *config.MetricTimestamps
+	}
+	reconnect := config.Reconnect != nil && *config.Reconnect
+	tlsConfig, err := newTLSConfig(config.TLS)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil && !strings.HasPrefix(url.Scheme, "tcp") {
+		return nil, fmt.Errorf("TLS requires a tcp BINRPC URI, not %q", url.Scheme)
+	}
+	timeout := DefaultTimeout
+	if config.Timeout != nil {
+		timeout = *config.Timeout
+	}
+	errorLogInterval := defaultErrorLogInterval
+	if config.ErrorLogInterval != nil {
+		errorLogInterval = *config.ErrorLogInterval
+	}
+	maxRetries := defaultMaxRetries
+	if config.MaxRetries != nil {
+		maxRetries = *config.MaxRetries
+	}
+	var counters *counterTracker
+	if config.TrackCounterAnomalies != nil && *config.TrackCounterAnomalies {
+		counters = newCounterTracker(logger)
+	}
+	conn := newBinrpcConn(url, reconnect, tlsConfig)
+	// the paths of the TLS files and the URI aren't exported, only whether TLS is used
+	settings := map[string]string{
+		"transport":            conn.transport(),
+		"timeout":              timeout.String(),
+		"min_scrape_interval":  minScrapeInterval.String(),
+		"metric_timestamps":    timestamps,
+		"max_retries":          strconv.Itoa(maxRetries),
+		"reconnect":            strconv.FormatBool(reconnect),
+		"enabled_collectors":   strconv.Itoa(len(collectors)),
+		"namespace":            namespace,
+		"tls":                  "off",
+		"normalize_uri_labels": strconv.FormatBool(config.NormalizeURILabels != nil && *config.NormalizeURILabels),
+	}
+	if tlsConfig != nil {
+		settings["tls"] = "verify"
+		if tlsConfig.InsecureSkipVerify {
+			settings["tls"] = "insecure"
+		}
+	}
+	descs := newExporterDescs(namespace)
+	return &KamailioCollector{
+		Collectors:          collectors,
+		logger:              logger,
+		timeout:             timeout,
+		dialErrors:          newErrorLimiter(errorLogInterval),
+		guard:               newScrapeGuard(descs.throttled, minScrapeInterval, timestamps),
+		conn:                conn,
+		tlsConfig:           tlsConfig,
+		maxRetries:          maxRetries,
+		counters:            counters,
+		descs:               descs,
+		rpcDuration:         rpcDuration,
+		retryableFaultCodes: retryableFaultCodes,
+		dialFailures:        &atomic.Int64{},
+		rpcFaults:           newRPCFaults(),
+		scrapeErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "", "scrape_errors_total"),
+			Help: "kamailio_exporter: Failed queries or parsings of a collector.",
+		}, []string{"collector"}),
+		settings:    settings,
+		probeGuards: newProbeGuards(descs.throttled, minScrapeInterval, timestamps),
+	}, nil
+}
+
+// NewWithConfig creates a collector from the main options, the others keep
+// their defaults. The collector implements prometheus.Collector, and is
+// registered like any other one:
+//
+//	c, err := collector.NewWithConfig(collector.Config{BinrpcURI: "tcp://127.0.0.1:2046"})
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//	registry.MustRegister(c)
+//
+// Each collector keeps its own settings and metric descriptors, several ones
+// can be created. Their metrics have the same names unless their namespaces
+// differ, so they go to different registries otherwise. Health reports the
+// last scrape of any of them.
+func NewWithConfig(config Config) (*KamailioCollector, error) {
+	logger := config.Logger
+	if logger == nil {
+		logger = log.NewNopLogger()
+	}
+	return NewKamailioCollector(config.kamailioCollectorConfig(), logger)
+}
+
+// ProbeCollector returns a collector scraping the given target with the same
+// collectors, for a single request. The target is a BINRPC URI, or a
+// "host:port" TCP address.
+func (n KamailioCollector) ProbeCollector(target string) (*KamailioCollector, error) {
+	if !strings.Contains(target, "://") {
+		target = "tcp://" + target
+	}
+	url, err := parseBinrpcURI(target)
+	if err != nil {
+		return nil, err
+	}
+	if n.tlsConfig != nil && !strings.HasPrefix(url.Scheme, "tcp") {
+		return nil, fmt.Errorf("TLS requires a tcp target, not %q", url.Scheme)
+	}
+	guard := n.probeGuards.get(url.String())
+	return &KamailioCollector{
+		Collectors:          n.Collectors,
+		logger:              log.With(n.logger, "target", target),
+		timeout:             n.timeout,
+		dialErrors:          n.dialErrors,
+		guard:               guard,
+		descs:               n.descs,
+		retryableFaultCodes: n.retryableFaultCodes,
+		conn:                newBinrpcConn(url, true, n.tlsConfig),
+		tlsConfig:           n.tlsConfig,
+		maxRetries:          n.maxRetries,
+		probe:               true,
+	}, nil
+}
+
+// parseBinrpcURI parses a "tcp://host:port", "udp://host:port" or
+// "unix:///path" URI. IPv6 literals can be bracketed, e.g.
+// "tcp://[fd00::1]:2046", or not, the port is then after the last colon.
+func parseBinrpcURI(uri string) (*url.URL, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse URI: %w", err)
+	}
+	switch u.Scheme {
+	case "tcp", "tcp4", "tcp6", "udp", "udp4", "udp6":
+		if u.Hostname() == "" || u.Port() == "" {
+			return nil, fmt.Errorf("URI %q has no host or port", uri)
+		}
+	case "unix":
+		if u.Path == "" {
+			return nil, fmt.Errorf("URI %q has no socket path", uri)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported URI scheme %q", u.Scheme)
+	}
+	return u, nil
+}
+
+// Prewarm opens the connection to Kamailio and runs system.listMethods on it,
+// so the first scrape doesn't wait for the dial. The connection is released
+// like after a scrape, so it's closed again in the reconnect mode.
+func (n KamailioCollector) Prewarm() error {
+	n.conn.Lock()
+	defer n.conn.Unlock()
+	conn, _, err := n.conn.get(time.Now().Add(n.timeout))
+	if err != nil {
+		return err
+	}
+	_, err = listMethods(conn, n.logger)
+	n.conn.release(err != nil)
+	return err
+}
+
+// Ping runs core.version on the connection to Kamailio, opening it if needed,
+// to tell whether Kamailio answers without a whole scrape.
+func (n KamailioCollector) Ping() error {
+	n.conn.Lock()
+	defer n.conn.Unlock()
+	deadline := time.Now().Add(n.timeout)
+	conn, reused, err := n.conn.get(deadline)
+	if err != nil {
+		return err
+	}
+	_, err = getRecords(conn, n.logger, "core.version")
+	if err != nil && reused && isConnectionError(err) {
+		// the connection went stale, e.g. kamailio restarted since the last scrape
+		n.conn.close()
+		if conn, _, err = n.conn.get(deadline); err != nil {
+			return err
+		}
+		_, err = getRecords(conn, n.logger, "core.version")
+	}
+	n.conn.release(isConnectionError(err))
+	return err
+}
+
+// WithTimeout returns a collector sharing the connection and the state of
+// this one, whose scrapes are limited to the given timeout when it's shorter
+// than the configured one.
+func (n KamailioCollector) WithTimeout(timeout time.Duration) *KamailioCollector {
+	if timeout > 0 && timeout < n.timeout {
+		n.timeout = timeout
+	}
+	return &n
+}
+
+// Close closes the connection to Kamailio, once the running scrape is done.
+func (n KamailioCollector) Close() {
+	n.conn.Lock()
+	defer n.conn.Unlock()
+	n.conn.close()
 }
 
 // Describe implements the prometheus.Collector interface.
 func (n KamailioCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- scrapeDurationDesc
-	ch <- scrapeSuccessDesc
+	ch <- n.descs.scrapeDuration
+	ch <- n.descs.scrapeTotalDuration
+	ch <- n.descs.scrapeSuccess
+	ch <- n.descs.startTime
+	if !n.probe {
+		n.rpcDuration.Describe(ch)
+		n.rpcFaults.Describe(ch)
+		n.scrapeErrors.Describe(ch)
+	}
+	for _, c := range n.Collectors {
+		c.Describe(ch)
+	}
 }
 
 // Collect implements the prometheus.Collector interface.
 func (n KamailioCollector) Collect(ch chan<- prometheus.Metric) {
-	var err error
-	var conn net.Conn
-	address := n.url.Host
+	n.guard.Collect(ch, func(ch chan<- prometheus.Metric) bool {
+		return n.counters.Collect(ch, n.collect)
+	})
+}
 
-	if n.url.Scheme == "unix" {
-		address = n.url.Path
+// collect scrapes Kamailio and tells whether the scrape failed, i.e. Kamailio
+// was down or a collector failed. A collector without data didn't fail.
+func (n KamailioCollector) collect(ch chan<- prometheus.Metric) (failed bool) {
+	scrapeBegin := time.Now()
+	defer func() {
+		ch <- prometheus.MustNewConstMetric(n.descs.scrapeTotalDuration, prometheus.GaugeValue, time.Since(scrapeBegin).Seconds())
+	}()
+	ch <- prometheus.MustNewConstMetric(n.descs.startTime, prometheus.GaugeValue, float64(startTime.UnixNano())/1e9)
+	if !n.probe {
+		defer n.rpcDuration.Collect(ch)
+		defer n.rpcFaults.Collect(ch)
+		defer n.scrapeErrors.Collect(ch)
+		for key, value := range n.settings {
+			ch <- prometheus.MustNewConstMetric(n.descs.config, prometheus.GaugeValue, 1, key, value)
+		}
 	}
 
-	conn, err = net.DialTimeout(n.url.Scheme, address, n.timeout)
-	if err != nil {
-		level.Error(n.logger).Log("msg", "Can not connect to kamailio", "err", err)
-		dialErrorCounter++
-		ch <- prometheus.MustNewConstMetric(kamailioDialFailureDesc, prometheus.CounterValue, float64(dialErrorCounter))
-		ch <- prometheus.MustNewConstMetric(kamailioUpDesc, prometheus.GaugeValue, 0)
-		return
-	}
+	ch <- prometheus.MustNewConstMetric(n.descs.transportInfo, prometheus.GaugeValue, 1, n.conn.transport(), n.conn.address)
 
-	err = conn.SetDeadline(time.Now().Add(n.timeout))
+	n.conn.Lock()
+	defer n.conn.Unlock()
+	broken := false
+	defer func() {
+		n.conn.release(broken)
+	}()
+
+	deadline := time.Now().Add(n.timeout)
+	conn, reused, err := n.conn.get(deadline)
 	if err != nil {
-		level.Error(n.logger).Log("msg", "Can not set deadline", "err", err)
+		n.dialFailed(ch, err)
+		return true
 	}
-	defer conn.Close()
 
-	runtimeMethods, err := listMethods(conn, ch, n.logger)
+	begin := time.Now()
+	// the collectors get the deadline of the scrape in their context
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	sc := &scrapeConn{Conn: conn, c: n.conn, deadline: deadline, maxRetries: n.maxRetries, rpcDuration: n.rpcDuration, rpcFaults: n.rpcFaults, retryableFaultCodes: n.retryableFaultCodes}
+	runtimeMethods, err := listMethods(sc, n.logger)
+	if err != nil && reused {
+		// the connection went stale, e.g. kamailio restarted since the last scrape
+		level.Debug(n.logger).Log("msg", "Reconnecting to kamailio", "err", err)
+		n.conn.close()
+		conn, _, err = n.conn.get(deadline)
+		if err != nil {
+			n.dialFailed(ch, err)
+			return true
+		}
+		begin = time.Now()
+		sc.Conn = conn
+		runtimeMethods, err = listMethods(sc, n.logger)
+	}
+	if !n.probe {
+		setUpStatus(err == nil)
+	}
 	if err != nil {
-		return
+		broken = true
+		n.scrapeFailed("system.listMethods")
+		ch <- prometheus.MustNewConstMetric(n.descs.up, prometheus.GaugeValue, 0)
+		ch <- prometheus.MustNewConstMetric(n.descs.scrapeSuccess, prometheus.GaugeValue, 0, "system.listMethods")
+		ch <- prometheus.MustNewConstMetric(n.descs.capability, prometheus.GaugeValue, 0, "system.listMethods")
+		return true
 	}
+	ch <- prometheus.MustNewConstMetric(n.descs.scrapeDuration, prometheus.GaugeValue, time.Since(begin).Seconds(), "system.listMethods")
+	ch <- prometheus.MustNewConstMetric(n.descs.scrapeSuccess, prometheus.GaugeValue, 1, "system.listMethods")
+	ch <- prometheus.MustNewConstMetric(n.descs.capability, prometheus.GaugeValue, 1, "system.listMethods")
 
+	// a timeout or a lost connection fails the following commands too, they are skipped
+	abortedBy := ""
 	for name, c := range n.Collectors {
+		status := CollectorStatus{Status: statusUnsupported}
 		if slices.Contains(runtimeMethods, name) {
-			execute(name, c, conn, ch, n.logger)
+			ch <- prometheus.MustNewConstMetric(n.descs.capability, prometheus.GaugeValue, 1, name)
+			if abortedBy != "" {
+				status = CollectorStatus{Status: statusSkipped, LastError: "skipped after " + abortedBy + " failed"}
+				ch <- prometheus.MustNewConstMetric(n.descs.scrapeSuccess, prometheus.GaugeValue, 0, name)
+			} else {
+				var err error
+				status, err = execute(ctx, name, c, sc, ch, n.descs, n.logger)
+				if status.Status == statusError {
+					failed = true
+					n.scrapeFailed(name)
+					// a fault leaves the connection usable, only a connection error closes it
+					if isConnectionError(err) {
+						broken = true
+						level.Warn(n.logger).Log("msg", "Connection to kamailio failed, skipping the remaining collectors", "collector", name, "err", err)
+						abortedBy = name
+					}
+				}
+			}
+		} else {
+			ch <- prometheus.MustNewConstMetric(n.descs.capability, prometheus.GaugeValue, 0, name)
 		}
+		if !n.probe {
+			setCollectorStatus(name, status)
+		}
+	}
+	// up once the collectors ran, Kamailio is down when it stopped answering mid-way
+	up := 1.0
+	if abortedBy != "" {
+		up = 0
+		ch <- prometheus.MustNewConstMetric(n.descs.scrapeAborted, prometheus.GaugeValue, 1, abortedBy)
 	}
+	ch <- prometheus.MustNewConstMetric(n.descs.up, prometheus.GaugeValue, up)
+	return failed
 }
 
-func listMethods(conn net.Conn, ch chan<- prometheus.Metric, logger log.Logger) ([]string, error) {
-	begin := time.Now()
+func (n KamailioCollector) scrapeFailed(name string) {
+	if !n.probe {
+		n.scrapeErrors.WithLabelValues(name).Inc()
+	}
+}
+
+func (n KamailioCollector) dialFailed(ch chan<- prometheus.Metric, err error) {
+	n.dialErrors.Log(n.logger, "Can not connect to kamailio", err)
+	ch <- prometheus.MustNewConstMetric(n.descs.up, prometheus.GaugeValue, 0)
+	if !n.probe {
+		ch <- prometheus.MustNewConstMetric(n.descs.dialFailure, prometheus.CounterValue, float64(n.dialFailures.Add(1)))
+		setUpStatus(false)
+	}
+}
+
+func listMethods(conn net.Conn, logger log.Logger) ([]string, error) {
 	records, err := getRecords(conn, logger, "system.listMethods")
 	if err != nil {
-		ch <- prometheus.MustNewConstMetric(kamailioUpDesc, prometheus.GaugeValue, 0)
-		ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 0, "system.listMethods")
 		return nil, err
 	}
 	runtimeMethods := make([]string, 0)
@@ -179,32 +658,52 @@ func listMethods(conn net.Conn, ch chan<- prometheus.Metric, logger log.Logger)
 		command, _ := item.String()
 		runtimeMethods = append(runtimeMethods, command)
 	}
-	duration := time.Since(begin)
-	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), "system.listMethods")
-	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, 1, "system.listMethods")
-	ch <- prometheus.MustNewConstMetric(kamailioUpDesc, prometheus.GaugeValue, 1)
 	return runtimeMethods, nil
 }
 
-func execute(name string, c Collector, conn net.Conn, ch chan<- prometheus.Metric, logger log.Logger) {
+func execute(ctx context.Context, name string, c SubCollector, conn net.Conn, ch chan<- prometheus.Metric, descs *exporterDescs, logger log.Logger) (CollectorStatus, error) {
+	// count the samples produced by the collector on the way
+	samples := 0
+	forward := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range forward {
+			samples++
+			ch <- m
+		}
+		close(done)
+	}()
+
 	begin := time.Now()
-	err := c.Update(conn, ch)
+	err := c.Collect(ctx, conn, forward)
 	duration := time.Since(begin)
+	close(forward)
+	<-done
 	var success float64
+	status := CollectorStatus{Status: statusOK, Duration: duration.Seconds()}
 
 	if err != nil {
 		if IsNoDataError(err) {
 			level.Debug(logger).Log("msg", "collector returned no data", "name", name, "duration_seconds", duration.Seconds(), "err", err)
 		} else {
 			level.Error(logger).Log("msg", "collector failed", "name", name, "duration_seconds", duration.Seconds(), "err", err)
+			status.Status = statusError
+			status.LastError = err.Error()
 		}
 		success = 0
 	} else {
 		level.Debug(logger).Log("msg", "collector succeeded", "name", name, "duration_seconds", duration.Seconds())
 		success = 1
+		// the command succeeded but returned nothing, e.g. an empty dispatcher list
+		var empty float64
+		if samples == 0 {
+			empty = 1
+		}
+		ch <- prometheus.MustNewConstMetric(descs.collectorEmpty, prometheus.GaugeValue, empty, name)
 	}
-	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
-	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	ch <- prometheus.MustNewConstMetric(descs.scrapeDuration, prometheus.GaugeValue, duration.Seconds(), name)
+	ch <- prometheus.MustNewConstMetric(descs.scrapeSuccess, prometheus.GaugeValue, success, name)
+	return status, err
 }
 
 // ErrNoData indicates the collector found no data to collect, but had no other error.
@@ -214,23 +713,142 @@ func IsNoDataError(err error) bool {
 	return err == ErrNoData
 }
 
-// Collector is the interface a collector has to implement.
-type Collector interface {
-	// Get new metrics and expose them via prometheus registry.
-	Update(conn net.Conn, ch chan<- prometheus.Metric) error
+// SubCollector is the interface a collector has to implement, it runs one
+// BINRPC command of a scrape.
+type SubCollector interface {
+	// Describe sends the descriptors of the metrics sent by Collect.
+	Describe(ch chan<- *prometheus.Desc)
+	// Collect runs the BINRPC commands on conn and sends the metrics. ctx
+	// ends with the scrape.
+	Collect(ctx context.Context, conn net.Conn, ch chan<- prometheus.Metric) error
 }
 
-func getRecords(conn net.Conn, logger log.Logger, values ...string) ([]binrpc.Record, error) {
-	cookie, err := binrpc.WritePacket(conn, values...)
+// newRPCDuration returns the histogram, or the summary if configured, observing the RPC durations.
+func newRPCDuration(config *KamailioCollectorConfig) (prometheus.ObserverVec, error) {
+	name := prometheus.BuildFQName(namespace, "exporter", "rpc_duration_seconds")
+	help := "kamailio_exporter: Duration of the BINRPC commands."
+	if config.RPCLatencySummary == nil || !*config.RPCLatencySummary {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    name,
+			Help:    help,
+			Buckets: rpcDurationBuckets,
+		}, []string{"method"}), nil
+	}
+	objectives, err := parseObjectives(config.RPCLatencyObjectives)
 	if err != nil {
-		level.Error(logger).Log("msg", "Can not request", "cmd", values[0], "err", err)
 		return nil, err
 	}
+	return prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Name:       name,
+		Help:       help,
+		Objectives: objectives,
+	}, []string{"method"}), nil
+}
+
+// parseObjectives parses summary objectives using the "QUANTILE:ERROR" format.
+func parseObjectives(values *[]string) (map[float64]float64, error) {
+	objectives := make(map[float64]float64)
+	if values == nil {
+		return objectives, nil
+	}
+	for _, value := range *values {
+		for _, objective := range strings.Split(value, ",") {
+			if objective == "" {
+				continue
+			}
+			entry := strings.Split(objective, ":")
+			if len(entry) != 2 {
+				return nil, fmt.Errorf("invalid summary objective %q", objective)
+			}
+			quantile, err := strconv.ParseFloat(entry[0], 64)
+			if err != nil || quantile <= 0 || quantile >= 1 {
+				return nil, fmt.Errorf("invalid summary quantile %q", objective)
+			}
+			epsilon, err := strconv.ParseFloat(entry[1], 64)
+			if err != nil || epsilon <= 0 {
+				return nil, fmt.Errorf("invalid summary error %q", objective)
+			}
+			objectives[quantile] = epsilon
+		}
+	}
+	return objectives, nil
+}
+
+// recordNumber returns the value of an integer or double record.
+func recordNumber(record binrpc.Record) (float64, bool) {
+	if i, err := record.Int(); err == nil {
+		return float64(i), true
+	}
+	if f, err := record.Double(); err == nil {
+		return f, true
+	}
+	return 0, false
+}
+
+// GetRecords runs a BINRPC command on the connection given to SubCollector.Collect.
+func GetRecords(conn net.Conn, logger log.Logger, values ...string) ([]binrpc.Record, error) {
+	return getRecords(conn, logger, values...)
+}
+
+func getRecords(conn net.Conn, logger log.Logger, values ...string) ([]binrpc.Record, error) {
+	begin := time.Now()
+	sc, _ := conn.(*scrapeConn)
+	codes := defaultRetryableFaultCodes
+	if sc != nil {
+		codes = sc.retryableFaultCodes
+	}
+	if sc != nil && sc.rpcDuration != nil {
+		defer func() {
+			sc.rpcDuration.WithLabelValues(values[0]).Observe(time.Since(begin).Seconds())
+		}()
+	}
 
-	records, err := binrpc.ReadPacket(conn, cookie)
+	records, err := request(conn, values...)
+	faults, retries := 0, 0
+	// the connection deadline bounds the retries
+	for err != nil {
+		if code, isFault := faultCode(err); isFault {
+			if sc != nil && sc.rpcFaults != nil {
+				sc.rpcFaults.WithLabelValues(values[0], strconv.Itoa(code)).Inc()
+			}
+			faults++
+			if faults > faultRetries || !isRetryableFault(codes, code) {
+				break
+			}
+			if sc != nil && time.Until(sc.deadline) < faultRetryDelay {
+				break
+			}
+			level.Debug(logger).Log("msg", "Retrying after a fault", "cmd", values[0], "code", code, "attempt", faults)
+			time.Sleep(faultRetryDelay)
+		} else if sc != nil && retries < sc.maxRetries && isTransientError(err) {
+			retries++
+			// retryBackoff, then twice as long each time
+			backoff := retryBackoff << (retries - 1)
+			if time.Until(sc.deadline) < backoff {
+				break
+			}
+			level.Debug(logger).Log("msg", "Reconnecting after an error", "cmd", values[0], "err", err, "attempt", retries)
+			time.Sleep(backoff)
+			if dialErr := sc.redial(); dialErr != nil {
+				break
+			}
+		} else {
+			break
+		}
+		records, err = request(conn, values...)
+	}
 	if err != nil {
 		level.Error(logger).Log("msg", "Can not fetch", "cmd", values[0], "err", err)
 		return nil, err
 	}
 	return records, nil
 }
+
+// request sends a BINRPC command and reads its reply.
+func request(conn net.Conn, values ...string) ([]binrpc.Record, error) {
+	cookie, err := binrpc.WritePacket(conn, values...)
+	if err != nil {
+		return nil, err
+	}
+	return binrpc.ReadPacket(conn, cookie)
+}
@@ -0,0 +1,125 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// groupAliases names the groups which aren't the module of their collectors.
+var groupAliases = map[string][]string{
+	"dialog": {"dlg.profile_get_size", "dlg.stats_active"},
+	"tcp":    {"core.tcp_info", "core.tcp_options"},
+	"stats":  {"stats.fetch"},
+}
+
+// statsGroups are statistics groups of stats.fetch without a collector of
+// their own, they are selected with --collector.stats.groups.
+var statsGroups = []string{"shmem", "usrloc", "registrar", "tsilo", "tmx"}
+
+// groupCollectors returns the collectors of a group. A group is a collector
+// name, the module of the collectors (e.g. "tm" for "tm.stats" and
+// "tm.hash_stats") or an alias.
+func groupCollectors(group string) ([]string, error) {
+	if collectors, ok := groupAliases[group]; ok {
+		return collectors, nil
+	}
+	collectors := make([]string, 0)
+	for _, name := range availableCollectors {
+		if name == group || strings.SplitN(name, ".", 2)[0] == group {
+			collectors = append(collectors, name)
+		}
+	}
+	if len(collectors) == 0 && slices.Contains(statsGroups, group) {
+		return nil, fmt.Errorf("%q is a statistics group of stats.fetch, not a collector group, select it with --collector.stats.groups", group)
+	}
+	if len(collectors) == 0 {
+		return nil, fmt.Errorf("unknown collector group %q", group)
+	}
+	return collectors, nil
+}
+
+// collectorStates returns which collectors are enabled, from their default
+// state, the per-collector overrides and the enabled then disabled groups.
+// Listing enabled groups disables the others. A collector whose options
+// aren't set stays disabled.
+func collectorStates(config *KamailioCollectorConfig) (map[string]bool, error) {
+	states := make(map[string]bool, len(collectorStateGlobal))
+	for name, enabled := range collectorStateGlobal {
+		states[name] = enabled
+	}
+	for name, enabled := range config.Collectors {
+		if _, ok := states[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		states[name] = enabled
+	}
+	enabled, err := parseGroups(config.CollectorsEnabled)
+	if err != nil {
+		return nil, err
+	}
+	if len(enabled) > 0 {
+		for name := range states {
+			states[name] = false
+		}
+		for _, name := range enabled {
+			states[name] = true
+		}
+	}
+	disabled, err := parseGroups(config.CollectorsDisabled)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range disabled {
+		states[name] = false
+	}
+	for name, configured := range collectorConfigured {
+		if states[name] && !configured(config) {
+			states[name] = false
+		}
+	}
+	return states, nil
+}
+
+// parseGroups returns the collectors of the comma separated groups.
+func parseGroups(values *[]string) ([]string, error) {
+	collectors := make([]string, 0)
+	if values == nil {
+		return collectors, nil
+	}
+	for _, value := range *values {
+		for _, group := range strings.Split(value, ",") {
+			group = strings.TrimSpace(group)
+			if group == "" {
+				continue
+			}
+			names, err := groupCollectors(group)
+			if err != nil {
+				return nil, err
+			}
+			collectors = append(collectors, names...)
+		}
+	}
+	return collectors, nil
+}
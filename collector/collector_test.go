@@ -0,0 +1,361 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCollectorsInSeveralNamespaces(t *testing.T) {
+	// nothing listens there, the scrapes only report Kamailio down
+	uri := "unix:///nonexistent/kamailio_ctl"
+	interval := time.Minute
+	newCollector := func(ns string) *KamailioCollector {
+		c, err := NewKamailioCollector(&KamailioCollectorConfig{BinrpcURI: &uri, Namespace: &ns, MinScrapeInterval: &interval}, log.NewNopLogger())
+		if err != nil {
+			t.Fatalf("NewKamailioCollector(%q): %v", ns, err)
+		}
+		return c
+	}
+	first := newCollector("first")
+	second := newCollector("second")
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(first); err != nil {
+		t.Fatalf("registering the first collector: %v", err)
+	}
+	if err := registry.Register(second); err != nil {
+		t.Fatalf("registering the second collector: %v", err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("gathering: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	for _, name := range []string{"first_up", "second_up", "first_exporter_config", "second_exporter_config", "first_exporter_throttled_scrapes_total", "second_exporter_throttled_scrapes_total"} {
+		if !names[name] {
+			t.Errorf("metric %s is missing, got %v", name, names)
+		}
+	}
+
+	// the probes of the first collector keep its namespace
+	probe, err := first.ProbeCollector("unix:///nonexistent/probed_ctl")
+	if err != nil {
+		t.Fatalf("ProbeCollector: %v", err)
+	}
+	if probed := gatherFamilies(t, probe); probed["first_exporter_throttled_scrapes_total"] == nil {
+		t.Errorf("the probe has no first_exporter_throttled_scrapes_total, got %v", probed)
+	}
+
+	if err := registry.Register(newCollector("first")); err == nil {
+		t.Errorf("registering a second collector in the same namespace succeeded")
+	}
+}
+
+func TestConfiguredCollectors(t *testing.T) {
+	enabled := true
+	noParams := []string{"", ","}
+	params := []string{"tcp.max_connections"}
+	noRealms, realms := 0, 10
+	tests := []struct {
+		name   string
+		config *KamailioCollectorConfig
+		want   bool
+	}{
+		{"core.ps", &KamailioCollectorConfig{}, false},
+		{"core.ps", &KamailioCollectorConfig{ProcessFds: ProcessFdsConfig{Enabled: &enabled}}, true},
+		{"cfg.get", &KamailioCollectorConfig{}, false},
+		{"cfg.get", &KamailioCollectorConfig{Cfg: CfgConfig{Params: &noParams}}, false},
+		{"cfg.get", &KamailioCollectorConfig{Cfg: CfgConfig{Params: &params}}, true},
+		{"ul.dump", &KamailioCollectorConfig{}, false},
+		{"ul.dump", &KamailioCollectorConfig{Usrloc: UsrlocConfig{RealmTopN: &noRealms}}, false},
+		{"ul.dump", &KamailioCollectorConfig{Usrloc: UsrlocConfig{RealmTopN: &realms}}, true},
+		{"tm.hash_stats", &KamailioCollectorConfig{}, false},
+		{"tm.hash_stats", &KamailioCollectorConfig{Tm: TmConfig{HashStats: &enabled}}, true},
+		{"tm.stats", &KamailioCollectorConfig{}, true},
+		{"dlg.profile_get_size", &KamailioCollectorConfig{}, false},
+		{"dlg.profile_get_size", &KamailioCollectorConfig{DialogProfile: DialogConfig{Profiles: &noParams}}, false},
+		{"dlg.profile_get_size", &KamailioCollectorConfig{DialogProfile: DialogConfig{Profiles: &params}}, true},
+	}
+	for _, test := range tests {
+		states, err := collectorStates(test.config)
+		if err != nil {
+			t.Fatalf("collectorStates: %v", err)
+		}
+		if states[test.name] != test.want {
+			t.Errorf("%s enabled = %t, want %t", test.name, states[test.name], test.want)
+		}
+	}
+}
+
+func TestParseGroups(t *testing.T) {
+	tests := []struct {
+		group string
+		err   string
+	}{
+		{"dialog", ""},
+		{"tm", ""},
+		{"core.runinfo", ""},
+		{"shmem", "--collector.stats.groups"},
+		{"nonexistent", "unknown collector group"},
+	}
+	for _, test := range tests {
+		_, err := parseGroups(&[]string{test.group})
+		if test.err == "" && err != nil {
+			t.Errorf("parseGroups(%q): %v", test.group, err)
+		} else if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("parseGroups(%q) error = %v, want %q", test.group, err, test.err)
+		}
+	}
+}
+
+// exampleCollector is a custom collector, as a site would register it.
+type exampleCollector struct {
+	calls *prometheus.Desc
+}
+
+func newExampleCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &exampleCollector{
+		calls: prometheus.NewDesc(prometheus.BuildFQName(MetricNamespace(config), "mymodule", "calls_total"), "Calls handled by the example module", nil, nil),
+	}, nil
+}
+
+func (c *exampleCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.calls
+}
+
+// Collect would run example.stats on conn, it reports the time left instead.
+func (c *exampleCollector) Collect(ctx context.Context, conn net.Conn, ch chan<- prometheus.Metric) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return ErrNoData
+	}
+	ch <- prometheus.MustNewConstMetric(c.calls, prometheus.CounterValue, time.Until(deadline).Seconds())
+	return nil
+}
+
+func init() {
+	Register("example.stats", false, newExampleCollector)
+}
+
+func TestRegister(t *testing.T) {
+	uri := "unix:///nonexistent/kamailio_ctl"
+	ns := "example"
+	c, err := NewKamailioCollector(&KamailioCollectorConfig{BinrpcURI: &uri, Namespace: &ns, Collectors: map[string]bool{"example.stats": true}}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewKamailioCollector: %v", err)
+	}
+	example, ok := c.Collectors["example.stats"].(*exampleCollector)
+	if !ok {
+		t.Fatalf("example.stats isn't enabled, got %v", c.Collectors)
+	}
+
+	descs := make(chan *prometheus.Desc)
+	go func() {
+		c.Describe(descs)
+		close(descs)
+	}()
+	described := false
+	for desc := range descs {
+		described = described || desc == example.calls
+	}
+	if !described {
+		t.Errorf("the collector doesn't describe %s", example.calls)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ch := make(chan prometheus.Metric, 10)
+	if status, err := execute(ctx, "example.stats", example, nil, ch, c.descs, log.NewNopLogger()); err != nil || status.Status != statusOK {
+		t.Fatalf("execute: %v %v", status, err)
+	}
+	metric := &dto.Metric{}
+	if err := (<-ch).Write(metric); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if left := metric.GetCounter().GetValue(); left <= 0 || left > 60 {
+		t.Errorf("got %v seconds left, want the scrape deadline", left)
+	}
+}
+
+func TestDescribeBuiltinCollectors(t *testing.T) {
+	uri := "unix:///nonexistent/kamailio_ctl"
+	enabled := true
+	params := []string{"tcp.max_connections"}
+	realms := 10
+	collectors := make(map[string]bool)
+	for name := range factories {
+		collectors[name] = true
+	}
+	c, err := NewKamailioCollector(&KamailioCollectorConfig{
+		BinrpcURI:     &uri,
+		Collectors:    collectors,
+		ProcessFds:    ProcessFdsConfig{Enabled: &enabled},
+		Cfg:           CfgConfig{Params: &params},
+		Usrloc:        UsrlocConfig{RealmTopN: &realms},
+		Tm:            TmConfig{HashStats: &enabled},
+		DialogProfile: DialogConfig{Profiles: &params},
+	}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewKamailioCollector: %v", err)
+	}
+	if len(c.Collectors) != len(factories) {
+		t.Errorf("got %d collectors, want %d", len(c.Collectors), len(factories))
+	}
+	// the registry rejects descriptors inconsistent with each other
+	if err := prometheus.NewPedanticRegistry().Register(c); err != nil {
+		t.Errorf("registering every collector: %v", err)
+	}
+}
+
+// gatherFamilies gathers c in a new registry, and returns the families by name.
+func gatherFamilies(t *testing.T, c prometheus.Collector) map[string]*dto.MetricFamily {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName
+}
+
+// labeledValues returns the values of a family by the value of its label.
+func labeledValues(family *dto.MetricFamily, label string) map[string]float64 {
+	values := make(map[string]float64)
+	for _, metric := range family.GetMetric() {
+		for _, pair := range metric.GetLabel() {
+			if pair.GetName() == label {
+				values[pair.GetValue()] = metric.GetGauge().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+func TestScrapeAbortedByConnectionError(t *testing.T) {
+	commands := []string{"sl.stats", "tm.stats", "core.runinfo"}
+	listMethods := binrpcReply(binrpcString("system.listMethods"), binrpcString(commands[0]), binrpcString(commands[1]), binrpcString(commands[2]))
+	// Kamailio closes the connection on the first command of the collectors
+	k := newFakeKamailio(func(args []string) fakeReply {
+		if args[0] == "system.listMethods" {
+			return listMethods
+		}
+		return fakeReply{hangUp: true}
+	})
+	// the probed Kamailio answers every command
+	probed := newFakeKamailio(func(args []string) fakeReply {
+		if args[0] == "system.listMethods" {
+			return listMethods
+		}
+		return binrpcReply(binrpcStruct(map[string][]byte{"200": binrpcInt(1), "current": binrpcInt(2), "uptime_secs": binrpcInt(3)}))
+	})
+	uri := k.listen(t)
+	probedURI := probed.listen(t)
+	retries := 0
+	c, err := NewKamailioCollector(&KamailioCollectorConfig{BinrpcURI: &uri, MaxRetries: &retries}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewKamailioCollector: %v", err)
+	}
+	defer c.Close()
+
+	// a probe runs the same collectors meanwhile
+	probe, err := c.ProbeCollector(probedURI)
+	if err != nil {
+		t.Fatalf("ProbeCollector: %v", err)
+	}
+	probeDone := make(chan map[string]*dto.MetricFamily)
+	go func() {
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(probe)
+		gathered, _ := registry.Gather()
+		families := make(map[string]*dto.MetricFamily)
+		for _, family := range gathered {
+			families[family.GetName()] = family
+		}
+		probeDone <- families
+	}()
+	families := gatherFamilies(t, c)
+	probeFamilies := <-probeDone
+	if success := labeledValues(probeFamilies["kamailio_scrape_collector_success"], "collector"); success["sl.stats"] != 1 || success["tm.stats"] != 1 || success["core.runinfo"] != 1 {
+		t.Errorf("probe: got collector_success %v, want 1 for each collector", success)
+	}
+	if up := probeFamilies["kamailio_up"]; up == nil || up.Metric[0].GetGauge().GetValue() != 1 {
+		t.Errorf("probe: got %v, want kamailio_up 1", up)
+	}
+
+	// Kamailio answered system.listMethods, but not the collectors
+	if up := families["kamailio_up"]; up == nil || up.Metric[0].GetGauge().GetValue() != 0 {
+		t.Errorf("got %v, want kamailio_up 0", up)
+	}
+	aborted := labeledValues(families["kamailio_exporter_scrape_aborted"], "collector")
+	if len(aborted) != 1 {
+		t.Fatalf("got scrape_aborted %v, want one collector", aborted)
+	}
+	var abortedBy string
+	for name := range aborted {
+		abortedBy = name
+	}
+	// the skipped collectors don't send their commands on the broken connection
+	if got := k.commands(); len(got) != 2 || got[0] != "system.listMethods" || got[1] != abortedBy {
+		t.Errorf("sent %v, want system.listMethods and %s only", got, abortedBy)
+	}
+	success := labeledValues(families["kamailio_scrape_collector_success"], "collector")
+	health := Health()
+	warnings := health.Warnings()
+	for _, name := range commands {
+		if v, ok := success[name]; !ok || v != 0 {
+			t.Errorf("%s: got collector_success %v, want 0", name, success)
+		}
+		want := statusSkipped
+		if name == abortedBy {
+			want = statusError
+		}
+		if status := health.Collectors[name].Status; status != want {
+			t.Errorf("%s: got health status %q, want %q", name, status, want)
+		}
+		if !slices.Contains(warnings, name+"="+want) {
+			t.Errorf("%s: got warnings %v, want %s=%s", name, warnings, name, want)
+		}
+	}
+
+	// the broken connection was closed, the next scrape dials a new one
+	gatherFamilies(t, c)
+	if got := k.accepted(); got != 2 {
+		t.Errorf("got %d connections, want 2", got)
+	}
+}
@@ -23,17 +23,113 @@ package collector
 
 import (
 	"time"
+
+	"github.com/go-kit/log"
+)
+
+// Defaults of the options left unset, the same as the flags of the exporter.
+const (
+	DefaultBinrpcURI        = "unix:///var/run/kamailio/kamailio_ctl"
+	DefaultTimeout          = 5 * time.Second
+	defaultErrorLogInterval = time.Minute
+	defaultMaxRetries       = 2
 )
 
+// Config holds the main options of NewWithConfig, to embed the collectors in
+// another program. KamailioCollectorConfig, given to NewKamailioCollector,
+// holds all of them.
+type Config struct {
+	// BINRPC URI of Kamailio, e.g. "tcp://127.0.0.1:2046" or
+	// "unix:///var/run/kamailio/kamailio_ctl". Defaults to DefaultBinrpcURI.
+	BinrpcURI string
+	// Timeout of a scrape. Defaults to DefaultTimeout.
+	Timeout time.Duration
+	// Groups of collectors to run, or to skip, like the --collectors.enabled
+	// and --collectors.disabled flags. All the collectors run by default.
+	EnabledCollectors  []string
+	DisabledCollectors []string
+	// Defaults to a logger discarding everything.
+	Logger log.Logger
+}
+
+// kamailioCollectorConfig returns the full configuration of the options.
+func (c Config) kamailioCollectorConfig() *KamailioCollectorConfig {
+	config := &KamailioCollectorConfig{
+		CollectorsEnabled:  &c.EnabledCollectors,
+		CollectorsDisabled: &c.DisabledCollectors,
+	}
+	if c.BinrpcURI != "" {
+		config.BinrpcURI = &c.BinrpcURI
+	}
+	if c.Timeout > 0 {
+		config.Timeout = &c.Timeout
+	}
+	return config
+}
+
 type KamailioCollectorConfig struct {
 	DialogProfile DialogConfig
 	DispatcherMap map[int]string
+	StatsFetch    StatsFetchConfig
+	ProcessFds    ProcessFdsConfig
+	Cfg           CfgConfig
+	Usrloc        UsrlocConfig
+	Tm            TmConfig
+	TLS           TLSConfig
+
+	Namespace         *string
+	BinrpcURI         *string
+	Timeout           *time.Duration
+	Reconnect         *bool
+	MaxRetries        *int
+	RetryFaultCodes   *[]string
+	ErrorLogInterval  *time.Duration
+	MinScrapeInterval *time.Duration
+	MetricTimestamps  *string
+	Collectors        map[string]bool
+
+	CollectorsEnabled  *[]string
+	CollectorsDisabled *[]string
 
-	BinrpcURI  *string
-	Timeout    *time.Duration
-	Collectors map[string]bool
+	TrackCounterAnomalies *bool
+	NormalizeURILabels    *bool
+
+	RPCLatencySummary    *bool
+	RPCLatencyObjectives *[]string
 }
 
 type DialogConfig struct {
 	Profiles *[]string
 }
+
+type StatsFetchConfig struct {
+	Groups         *[]string
+	FloatPrecision *int
+	ResponseCodes  *[]string
+	MappingFile    *string
+}
+
+type ProcessFdsConfig struct {
+	Enabled *bool
+}
+
+type CfgConfig struct {
+	Params *[]string
+}
+
+type UsrlocConfig struct {
+	RealmTopN *int
+}
+
+type TmConfig struct {
+	HashStats *bool
+}
+
+type TLSConfig struct {
+	Enabled            *bool
+	CAFile             *string
+	CertFile           *string
+	KeyFile            *string
+	ServerName         *string
+	InsecureSkipVerify *bool
+}
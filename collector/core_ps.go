@@ -0,0 +1,96 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+func init() {
+	// /proc is only meaningful when running next to kamailio
+	registerConfiguredCollector("core.ps", func(config *KamailioCollectorConfig) bool {
+		return config.ProcessFds.Enabled != nil && *config.ProcessFds.Enabled
+	}, NewCorePsCollector)
+}
+
+type corePsCollector struct {
+	openFds *prometheus.Desc
+	maxFds  *prometheus.Desc
+	logger  log.Logger
+	config  *KamailioCollectorConfig
+}
+
+// NewCorePsCollector returns a new Collector exposing file descriptors usage of Kamailio processes.
+func NewCorePsCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &corePsCollector{
+		openFds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "open_fds"),
+			"Number of open file descriptors",
+			[]string{"pid"}, nil),
+		maxFds: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "max_fds"),
+			"Maximum number of open file descriptors",
+			[]string{"pid"}, nil),
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (c *corePsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openFds
+	ch <- c.maxFds
+}
+
+func (c *corePsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, "core.ps")
+	if err != nil {
+		return err
+	}
+
+	// the reply is a flat list of pid and description pairs
+	for i := 0; i < len(records); i += 2 {
+		pid, err := records[i].Int()
+		if err != nil {
+			continue
+		}
+		proc, err := procfs.NewProc(pid)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "Can not read process", "pid", pid, "err", err)
+			continue
+		}
+		spid := strconv.Itoa(pid)
+		if fds, err := proc.FileDescriptorsLen(); err == nil {
+			metricChannel <- prometheus.MustNewConstMetric(c.openFds, prometheus.GaugeValue, float64(fds), spid)
+		}
+		if limits, err := proc.Limits(); err == nil {
+			metricChannel <- prometheus.MustNewConstMetric(c.maxFds, prometheus.GaugeValue, float64(limits.OpenFiles), spid)
+		}
+	}
+	return nil
+}
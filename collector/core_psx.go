@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 	"strconv"
 
@@ -40,7 +41,7 @@ type CorePsxCollector struct {
 }
 
 // NewDispatcherListCollector returns a new Collector exposing core processes stats.
-func NewCorePsaCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewCorePsaCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &CorePsxCollector{
 		coreProcessStatus: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "core_process_status"),
@@ -51,7 +52,11 @@ func NewCorePsaCollector(config *KamailioCollectorConfig, logger log.Logger) (Co
 	}, nil
 }
 
-func (c *CorePsxCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *CorePsxCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.coreProcessStatus
+}
+
+func (c *CorePsxCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "core.psa")
 	if err != nil {
 		return err
@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 
 	"github.com/go-kit/log"
@@ -39,7 +40,7 @@ type CoreRuninfoCollector struct {
 }
 
 // NewStatsFetchCollector returns a new Collector exposing core stats.
-func NewCoreRuninfoCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewCoreRuninfoCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &CoreRuninfoCollector{
 		coreUptime: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "core_uptime"),
@@ -50,7 +51,11 @@ func NewCoreRuninfoCollector(config *KamailioCollectorConfig, logger log.Logger)
 	}, nil
 }
 
-func (c *CoreRuninfoCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *CoreRuninfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.coreUptime
+}
+
+func (c *CoreRuninfoCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "core.runinfo")
 	if err != nil {
 		return err
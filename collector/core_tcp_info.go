@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 
 	"github.com/go-kit/log"
@@ -35,6 +36,7 @@ func init() {
 type coreTCPInfoCollector struct {
 	tcpReaders        *prometheus.Desc
 	tcpMaxConnections *prometheus.Desc
+	tcpConnections    *prometheus.Desc
 	tlsMaxConnections *prometheus.Desc
 	tlsConnections    *prometheus.Desc
 	logger            log.Logger
@@ -42,7 +44,7 @@ type coreTCPInfoCollector struct {
 }
 
 // NewCoreStatsCollector returns a new Collector exposing core stats.
-func NewCoreTCPInfoCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewCoreTCPInfoCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &coreTCPInfoCollector{
 		tcpReaders: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "tcp_readers"),
@@ -52,6 +54,10 @@ func NewCoreTCPInfoCollector(config *KamailioCollectorConfig, logger log.Logger)
 			prometheus.BuildFQName(namespace, "", "tcp_max_connections"),
 			"TCP connection limit",
 			[]string{}, nil),
+		tcpConnections: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "tcp_opened_connections"),
+			"Opened TCP connections, TLS included",
+			[]string{}, nil),
 		tlsMaxConnections: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "tls_max_connections"),
 			"TLS connection limit",
@@ -65,13 +71,24 @@ func NewCoreTCPInfoCollector(config *KamailioCollectorConfig, logger log.Logger)
 	}, nil
 }
 
-func (c *coreTCPInfoCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *coreTCPInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.tcpReaders
+	ch <- c.tcpMaxConnections
+	ch <- c.tcpConnections
+	ch <- c.tlsMaxConnections
+	ch <- c.tlsConnections
+}
+
+func (c *coreTCPInfoCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	// fetch tcp details
 	records, err := getRecords(conn, c.logger, "core.tcp_info")
 	if err != nil {
 		return err
 	}
 
+	if len(records) == 0 {
+		return ErrNoData
+	}
 	items, _ := records[0].StructItems()
 	var v int
 	for _, item := range items {
@@ -82,6 +99,9 @@ func (c *coreTCPInfoCollector) Update(conn net.Conn, metricChannel chan<- promet
 		case "max_connections":
 			v, _ = item.Value.Int()
 			metricChannel <- prometheus.MustNewConstMetric(c.tcpMaxConnections, prometheus.GaugeValue, float64(v))
+		case "opened_connections":
+			v, _ = item.Value.Int()
+			metricChannel <- prometheus.MustNewConstMetric(c.tcpConnections, prometheus.GaugeValue, float64(v))
 		case "max_tls_connections":
 			v, _ = item.Value.Int()
 			metricChannel <- prometheus.MustNewConstMetric(c.tlsMaxConnections, prometheus.GaugeValue, float64(v))
@@ -0,0 +1,83 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("core.tcp_options", defaultEnabled, NewCoreTCPOptionsCollector)
+}
+
+type coreTCPOptionsCollector struct {
+	gauges map[string]*prometheus.Desc
+	logger log.Logger
+	config *KamailioCollectorConfig
+}
+
+// NewCoreTCPOptionsCollector returns a new Collector exposing TCP buffer settings.
+func NewCoreTCPOptionsCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	gauges := map[string]*prometheus.Desc{
+		"rd_buf_size":  prometheus.NewDesc(prometheus.BuildFQName(namespace, "tcp_options", "read_buffer_bytes"), "TCP read buffer size.", []string{}, nil),
+		"wq_blk_size":  prometheus.NewDesc(prometheus.BuildFQName(namespace, "tcp_options", "write_queue_block_bytes"), "TCP write queue block size.", []string{}, nil),
+		"wq_max":       prometheus.NewDesc(prometheus.BuildFQName(namespace, "tcp_options", "write_queue_max_bytes"), "Maximum TCP write queue size per connection.", []string{}, nil),
+		"conn_wq_max":  prometheus.NewDesc(prometheus.BuildFQName(namespace, "tcp_options", "connection_write_queue_max_bytes"), "Maximum TCP write queue size while connecting.", []string{}, nil),
+		"send_timeout": prometheus.NewDesc(prometheus.BuildFQName(namespace, "tcp_options", "send_timeout_seconds"), "TCP send timeout in seconds.", []string{}, nil),
+	}
+	return &coreTCPOptionsCollector{
+		gauges: gauges,
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (c *coreTCPOptionsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.gauges {
+		ch <- desc
+	}
+}
+
+func (c *coreTCPOptionsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, "core.tcp_options")
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		items, _ := record.StructItems()
+		for _, item := range items {
+			if desc, ok := c.gauges[item.Key]; ok {
+				i, err := item.Value.Int()
+				if err != nil {
+					continue
+				}
+				metricChannel <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(i))
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// counterTracker compares the counters of each scrape with the previous one.
+type counterTracker struct {
+	mtx       sync.Mutex
+	logger    log.Logger
+	anomalies *prometheus.Desc
+	// uptime of kamailio, used to tell a restart from a counter going backwards
+	uptimeName string
+	values     map[string]float64
+	uptime     float64
+	counts     map[string]int
+}
+
+func newCounterTracker(logger log.Logger) *counterTracker {
+	return &counterTracker{
+		logger: logger,
+		anomalies: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "exporter", "counter_anomalies_total"),
+			"kamailio_exporter: Number of times a counter decreased while Kamailio didn't restart.",
+			[]string{"metric"},
+			nil,
+		),
+		uptimeName: prometheus.BuildFQName(namespace, "", "core_uptime"),
+		values:     make(map[string]float64),
+		uptime:     -1,
+		counts:     make(map[string]int),
+	}
+}
+
+// Collect calls collect and counts the counters which decreased since the
+// previous call, unless the uptime of Kamailio went back too. A nil tracker
+// only calls collect. It returns the result of collect.
+func (t *counterTracker) Collect(ch chan<- prometheus.Metric, collect func(chan<- prometheus.Metric) bool) bool {
+	if t == nil {
+		return collect(ch)
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	var scraped scrapedMetrics
+	forward := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range forward {
+			ch <- m
+			scraped = append(scraped, m)
+		}
+		close(done)
+	}()
+	failed := collect(forward)
+	close(forward)
+	<-done
+
+	values, uptime := t.counterValues(scraped)
+	restarted := uptime >= 0 && uptime < t.uptime
+	if !restarted {
+		for key, value := range values {
+			if previous, ok := t.values[key]; ok && value < previous {
+				level.Warn(t.logger).Log("msg", "Counter decreased", "metric", key, "previous", previous, "value", value)
+				t.counts[strings.SplitN(key, "{", 2)[0]]++
+			}
+		}
+	}
+	// keep the counters missing from this scrape, a collector may have failed
+	for key, value := range values {
+		t.values[key] = value
+	}
+	if uptime >= 0 {
+		t.uptime = uptime
+	}
+
+	for name, count := range t.counts {
+		ch <- prometheus.MustNewConstMetric(t.anomalies, prometheus.CounterValue, float64(count), name)
+	}
+	return failed
+}
+
+// counterValues gathers the scraped metrics and returns the value of each
+// counter, keyed by its name with the labels, and the uptime of Kamailio,
+// -1 when it is missing.
+func (t *counterTracker) counterValues(scraped scrapedMetrics) (map[string]float64, float64) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(scraped)
+	// the families gathered despite an error are still compared
+	families, err := registry.Gather()
+	if err != nil {
+		level.Debug(t.logger).Log("msg", "Gathering the counters failed", "err", err)
+	}
+	values := make(map[string]float64)
+	uptime := float64(-1)
+	for _, family := range families {
+		switch {
+		case family.GetType() == dto.MetricType_COUNTER:
+			for _, metric := range family.Metric {
+				values[counterKey(family.GetName(), metric)] = metric.GetCounter().GetValue()
+			}
+		case family.GetName() == t.uptimeName && len(family.Metric) > 0:
+			uptime = family.Metric[0].GetGauge().GetValue()
+		}
+	}
+	return values, uptime
+}
+
+// counterKey returns the name of a counter with its labels.
+func counterKey(name string, metric *dto.Metric) string {
+	// the registry sorts the labels
+	labels := make([]string, 0, len(metric.Label))
+	for _, label := range metric.Label {
+		labels = append(labels, label.GetName()+"="+label.GetValue())
+	}
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// scrapedMetrics replays the metrics of a scrape to a registry. It describes
+// nothing, so the registry doesn't check them against descriptors.
+type scrapedMetrics []prometheus.Metric
+
+func (s scrapedMetrics) Describe(chan<- *prometheus.Desc) {}
+
+func (s scrapedMetrics) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range s {
+		ch <- m
+	}
+}
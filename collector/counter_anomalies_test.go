@@ -0,0 +1,89 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCounterTrackerAnomalies(t *testing.T) {
+	tracker := newCounterTracker(log.NewNopLogger())
+	requests := prometheus.NewDesc("kamailio_requests_total", "", []string{"method"}, nil)
+	uptime := prometheus.NewDesc(tracker.uptimeName, "", nil, nil)
+	tests := []struct {
+		name      string
+		requests  float64
+		uptime    float64
+		anomalies float64
+	}{
+		{"first scrape", 10, 100, -1},
+		{"increase", 20, 110, -1},
+		{"decrease", 15, 120, 1},
+		{"restart", 5, 10, 1},
+		{"decrease again", 1, 20, 2},
+	}
+	for _, test := range tests {
+		collect := func(ch chan<- prometheus.Metric) bool {
+			ch <- prometheus.MustNewConstMetric(requests, prometheus.CounterValue, test.requests, "INVITE")
+			ch <- prometheus.MustNewConstMetric(uptime, prometheus.GaugeValue, test.uptime)
+			return false
+		}
+		anomalies := float64(-1)
+		for _, m := range collectAllCounters(tracker, collect) {
+			if m.Desc() != tracker.anomalies {
+				continue
+			}
+			metric := &dto.Metric{}
+			if err := m.Write(metric); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if metric.Label[0].GetValue() != "kamailio_requests_total" {
+				t.Errorf("%s: got anomalies of %q", test.name, metric.Label[0].GetValue())
+			}
+			anomalies = metric.GetCounter().GetValue()
+		}
+		if anomalies != test.anomalies {
+			t.Errorf("%s: got %v anomalies, want %v", test.name, anomalies, test.anomalies)
+		}
+	}
+}
+
+// collectAllCounters runs the tracker and returns the metrics it sent.
+func collectAllCounters(tracker *counterTracker, collect func(chan<- prometheus.Metric) bool) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	metrics := make([]prometheus.Metric, 0)
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+	tracker.Collect(ch, collect)
+	close(ch)
+	<-done
+	return metrics
+}
@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -55,6 +56,7 @@ type DispatcherTarget struct {
 	LatencyEst     float64
 	LatencyMax     float64
 	LatencyTimeout float64
+	HasLatency     bool
 }
 
 type dispatcherListCollector struct {
@@ -69,11 +71,14 @@ type dispatcherListCollector struct {
 	weight         *prometheus.Desc
 	rweight        *prometheus.Desc
 	priority       *prometheus.Desc
+	rtt            *prometheus.Desc
+	probing        *prometheus.Desc
+	state          *prometheus.Desc
 	config         *KamailioCollectorConfig
 }
 
 // NewCoreStatsCollector returns a new Collector exposing core stats.
-func NewDispatcherListCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewDispatcherListCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &dispatcherListCollector{
 		config:         config,
 		logger:         logger,
@@ -87,10 +92,37 @@ func NewDispatcherListCollector(config *KamailioCollectorConfig, logger log.Logg
 		weight:         prometheus.NewDesc(prometheus.BuildFQName(namespace, "dispatcher_list", "target_weight"), "Target Weight.", []string{"set_id", "destination", "set_name"}, nil),
 		rweight:        prometheus.NewDesc(prometheus.BuildFQName(namespace, "dispatcher_list", "target_rweight"), "Target rweight.", []string{"set_id", "destination", "set_name"}, nil),
 		priority:       prometheus.NewDesc(prometheus.BuildFQName(namespace, "dispatcher_list", "target_priority"), "Target Priority.", []string{"set_id", "destination", "set_name"}, nil),
+		rtt:            prometheus.NewDesc(prometheus.BuildFQName(namespace, "dispatcher_list", "target_rtt_seconds"), "Target average probing round-trip time.", []string{"set_id", "destination", "set_name"}, nil),
+		probing:        prometheus.NewDesc(prometheus.BuildFQName(namespace, "dispatcher_list", "target_probing"), "Whether the target is being probed.", []string{"set_id", "destination", "set_name"}, nil),
+		state:          prometheus.NewDesc(prometheus.BuildFQName(namespace, "dispatcher_list", "target_state"), "Target state: 0 inactive, 1 active, 2 trying, 3 disabled.", []string{"set_id", "destination", "set_name"}, nil),
 	}, nil
 }
 
-func (c *dispatcherListCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+// the first flag is the state of the target, the second one "P" when probing or "X"
+var dispatcherStates = map[byte]float64{
+	'I': 0,
+	'A': 1,
+	'T': 2,
+	'D': 3,
+}
+
+func (c *dispatcherListCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.target
+	ch <- c.targetFlags
+	ch <- c.latencyAvg
+	ch <- c.latencyStd
+	ch <- c.latencyEst
+	ch <- c.latencyMax
+	ch <- c.latencyTimeout
+	ch <- c.weight
+	ch <- c.rweight
+	ch <- c.priority
+	ch <- c.rtt
+	ch <- c.probing
+	ch <- c.state
+}
+
+func (c *dispatcherListCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "dispatcher.list")
 	if err != nil {
 		return err
@@ -102,19 +134,41 @@ func (c *dispatcherListCollector) Update(conn net.Conn, metricChannel chan<- pro
 	}
 
 	// convert each pkg entry to a series of metrics
+	seen := make(map[string]bool)
 	for _, target := range targets {
 		setID := fmt.Sprintf("%d", target.ID)
 		setName := c.config.DispatcherMap[target.ID]
-		metricChannel <- prometheus.MustNewConstMetric(c.target, prometheus.GaugeValue, target.Status, setID, target.URI, setName)
-		metricChannel <- prometheus.MustNewConstMetric(c.targetFlags, prometheus.GaugeValue, 1, setID, target.URI, setName, target.Flags)
-		metricChannel <- prometheus.MustNewConstMetric(c.latencyAvg, prometheus.GaugeValue, target.LatencyAvg, setID, target.URI, setName)
-		metricChannel <- prometheus.MustNewConstMetric(c.latencyStd, prometheus.GaugeValue, target.LatencyStd, setID, target.URI, setName)
-		metricChannel <- prometheus.MustNewConstMetric(c.latencyEst, prometheus.GaugeValue, target.LatencyEst, setID, target.URI, setName)
-		metricChannel <- prometheus.MustNewConstMetric(c.latencyMax, prometheus.GaugeValue, target.LatencyMax, setID, target.URI, setName)
-		metricChannel <- prometheus.MustNewConstMetric(c.latencyTimeout, prometheus.GaugeValue, target.LatencyTimeout, setID, target.URI, setName)
-		metricChannel <- prometheus.MustNewConstMetric(c.priority, prometheus.GaugeValue, float64(target.Priority), setID, target.URI, setName)
-		metricChannel <- prometheus.MustNewConstMetric(c.weight, prometheus.GaugeValue, float64(target.Weight), setID, target.URI, setName)
-		metricChannel <- prometheus.MustNewConstMetric(c.rweight, prometheus.GaugeValue, float64(target.RWeight), setID, target.URI, setName)
+		uri := uriLabel(c.config, target.URI)
+		// normalized URIs of the same set may collide, e.g. differing by the transport
+		if seen[setID+" "+uri] {
+			level.Warn(c.logger).Log("msg", "Skipping duplicate dispatcher target", "set_id", setID, "destination", target.URI)
+			continue
+		}
+		seen[setID+" "+uri] = true
+		metricChannel <- prometheus.MustNewConstMetric(c.target, prometheus.GaugeValue, target.Status, setID, uri, setName)
+		metricChannel <- prometheus.MustNewConstMetric(c.targetFlags, prometheus.GaugeValue, 1, setID, uri, setName, target.Flags)
+		metricChannel <- prometheus.MustNewConstMetric(c.latencyAvg, prometheus.GaugeValue, target.LatencyAvg, setID, uri, setName)
+		metricChannel <- prometheus.MustNewConstMetric(c.latencyStd, prometheus.GaugeValue, target.LatencyStd, setID, uri, setName)
+		metricChannel <- prometheus.MustNewConstMetric(c.latencyEst, prometheus.GaugeValue, target.LatencyEst, setID, uri, setName)
+		metricChannel <- prometheus.MustNewConstMetric(c.latencyMax, prometheus.GaugeValue, target.LatencyMax, setID, uri, setName)
+		metricChannel <- prometheus.MustNewConstMetric(c.latencyTimeout, prometheus.GaugeValue, target.LatencyTimeout, setID, uri, setName)
+		metricChannel <- prometheus.MustNewConstMetric(c.priority, prometheus.GaugeValue, float64(target.Priority), setID, uri, setName)
+		metricChannel <- prometheus.MustNewConstMetric(c.weight, prometheus.GaugeValue, float64(target.Weight), setID, uri, setName)
+		metricChannel <- prometheus.MustNewConstMetric(c.rweight, prometheus.GaugeValue, float64(target.RWeight), setID, uri, setName)
+		var probing float64
+		if strings.Contains(target.Flags, "P") {
+			probing = 1
+		}
+		metricChannel <- prometheus.MustNewConstMetric(c.probing, prometheus.GaugeValue, probing, setID, uri, setName)
+		if target.Flags != "" {
+			if state, ok := dispatcherStates[target.Flags[0]]; ok {
+				metricChannel <- prometheus.MustNewConstMetric(c.state, prometheus.GaugeValue, state, setID, uri, setName)
+			}
+		}
+		// latency is only reported when the latency stats are enabled in dispatcher
+		if target.HasLatency {
+			metricChannel <- prometheus.MustNewConstMetric(c.rtt, prometheus.GaugeValue, target.LatencyAvg/1000, setID, uri, setName)
+		}
 	}
 	return nil
 }
@@ -223,7 +277,8 @@ func parseDestinations(setID int, destinations []binrpc.StructItem) ([]Dispatche
 				if err != nil {
 					return nil, err
 				}
-				if target.Flags == "AP" {
+				// active, whether probed ("AP") or not ("AX")
+				if strings.HasPrefix(target.Flags, "A") {
 					target.Status = 1
 				}
 			case "PRIORITY":
@@ -232,12 +287,12 @@ func parseDestinations(setID int, destinations []binrpc.StructItem) ([]Dispatche
 					return nil, err
 				}
 			case "ATTRS":
-				err := parseDestinationAttributes(prop, target)
+				err := parseDestinationAttributes(prop, &target)
 				if err != nil {
 					return nil, err
 				}
 			case "LATENCY":
-				err := parseDestinationLatency(prop, target)
+				err := parseDestinationLatency(prop, &target)
 				if err != nil {
 					return nil, err
 				}
@@ -249,11 +304,12 @@ func parseDestinations(setID int, destinations []binrpc.StructItem) ([]Dispatche
 	return targets, nil
 }
 
-func parseDestinationLatency(prop binrpc.StructItem, target DispatcherTarget) error {
+func parseDestinationLatency(prop binrpc.StructItem, target *DispatcherTarget) error {
 	latency, err := prop.Value.StructItems()
 	if err != nil {
 		return err
 	}
+	target.HasLatency = true
 	for _, attr := range latency {
 		switch attr.Key {
 		case "AVG":
@@ -271,7 +327,7 @@ func parseDestinationLatency(prop binrpc.StructItem, target DispatcherTarget) er
 	return nil
 }
 
-func parseDestinationAttributes(prop binrpc.StructItem, target DispatcherTarget) error {
+func parseDestinationAttributes(prop binrpc.StructItem, target *DispatcherTarget) error {
 	attrs, err := prop.Value.StructItems()
 	if err != nil {
 		return err
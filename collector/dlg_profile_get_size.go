@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 
 	"github.com/go-kit/log"
@@ -29,7 +30,9 @@ import (
 )
 
 func init() {
-	registerCollector("dlg.profile_get_size", defaultEnabled, NewDlgProfileCollector)
+	registerConfiguredCollector("dlg.profile_get_size", func(config *KamailioCollectorConfig) bool {
+		return hasListValue(config.DialogProfile.Profiles)
+	}, NewDlgProfileCollector)
 }
 
 type dlgProfileCollector struct {
@@ -39,7 +42,7 @@ type dlgProfileCollector struct {
 }
 
 // NewCoreStatsCollector returns a new Collector exposing core stats.
-func NewDlgProfileCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewDlgProfileCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &dlgProfileCollector{
 		dialog: prometheus.NewDesc(prometheus.BuildFQName(namespace, "dlg_profile_get_size", "dialog"), "Current number of dialogs belonging to a profile.", []string{"profile"}, nil),
 		config: config,
@@ -47,8 +50,15 @@ func NewDlgProfileCollector(config *KamailioCollectorConfig, logger log.Logger)
 	}, nil
 }
 
-func (c *dlgProfileCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *dlgProfileCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.dialog
+}
+
+func (c *dlgProfileCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	for _, p := range *c.config.DialogProfile.Profiles {
+		if p == "" {
+			continue
+		}
 		records, err := getRecords(conn, c.logger, "dlg.profile_get_size", p)
 		if err != nil {
 			return err
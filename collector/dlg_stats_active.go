@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 
 	"github.com/go-kit/log"
@@ -39,7 +40,7 @@ type dlgStatsActiveCollector struct {
 }
 
 // NewCoreStatsCollector returns a new Collector exposing core stats.
-func NewDlgStatsActiveCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewDlgStatsActiveCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	gauges := map[string]*prometheus.Desc{
 		"starting":   prometheus.NewDesc(prometheus.BuildFQName(namespace, "dlg_stats_active", "starting"), "Dialog starting.", []string{}, nil),
 		"connecting": prometheus.NewDesc(prometheus.BuildFQName(namespace, "dlg_stats_active", "connecting"), "Dialog connecting.", []string{}, nil),
@@ -54,7 +55,13 @@ func NewDlgStatsActiveCollector(config *KamailioCollectorConfig, logger log.Logg
 	}, nil
 }
 
-func (c *dlgStatsActiveCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *dlgStatsActiveCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range c.gauges {
+		ch <- desc
+	}
+}
+
+func (c *dlgStatsActiveCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "dlg.stats_active")
 	if err != nil {
 		return err
@@ -0,0 +1,79 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("dst_blocklist.view", defaultEnabled, newDstBlocklistViewCollector("dst_blocklist.view"))
+	// name used before Kamailio 5.5
+	registerCollector("dst_blacklist.view", defaultEnabled, newDstBlocklistViewCollector("dst_blacklist.view"))
+}
+
+type dstBlocklistViewCollector struct {
+	command string
+	entries *prometheus.Desc
+	logger  log.Logger
+	config  *KamailioCollectorConfig
+}
+
+// newDstBlocklistViewCollector returns a factory of Collector exposing the destination blocklist size.
+func newDstBlocklistViewCollector(command string) func(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return func(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+		return &dstBlocklistViewCollector{
+			command: command,
+			entries: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "dns", "blocklist_entries"),
+				"Number of destinations in the blocklist",
+				[]string{}, nil),
+			config: config,
+			logger: logger,
+		}, nil
+	}
+}
+
+func (c *dstBlocklistViewCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.entries
+}
+
+func (c *dstBlocklistViewCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, c.command)
+	if err != nil {
+		return err
+	}
+
+	// one struct is returned per blocklisted destination
+	var entries int
+	for _, record := range records {
+		if items, err := record.StructItems(); err == nil && len(items) > 0 {
+			entries++
+		}
+	}
+	metricChannel <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(entries))
+	return nil
+}
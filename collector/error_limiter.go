@@ -0,0 +1,65 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+// errorLimiter suppresses identical errors logged more than once per interval.
+type errorLimiter struct {
+	mtx        sync.Mutex
+	interval   time.Duration
+	lastErr    string
+	lastLogged time.Time
+	suppressed int
+}
+
+func newErrorLimiter(interval time.Duration) *errorLimiter {
+	return &errorLimiter{interval: interval}
+}
+
+// Log logs msg and err at error level, unless the same error was already
+// logged during the interval. The number of suppressed entries is reported
+// with the next logged one.
+func (l *errorLimiter) Log(logger log.Logger, msg string, err error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	now := time.Now()
+	if l.interval > 0 && err.Error() == l.lastErr && now.Sub(l.lastLogged) < l.interval {
+		l.suppressed++
+		return
+	}
+	if l.suppressed > 0 {
+		level.Error(logger).Log("msg", msg, "err", err, "suppressed", l.suppressed)
+	} else {
+		level.Error(logger).Log("msg", msg, "err", err)
+	}
+	l.lastErr = err.Error()
+	l.lastLogged = now
+	l.suppressed = 0
+}
@@ -0,0 +1,325 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// BINRPC record types, see binrpc.h in the ctl module of Kamailio
+const (
+	binrpcTypeInt    = 0
+	binrpcTypeString = 1
+	binrpcTypeStruct = 3
+	binrpcTypeAVP    = 5
+)
+
+// fakeReply is the reply of the fake Kamailio to a command.
+type fakeReply struct {
+	fault   bool
+	records [][]byte
+	// closes the connection instead of replying
+	hangUp bool
+}
+
+func binrpcReply(records ...[]byte) fakeReply {
+	return fakeReply{records: records}
+}
+
+func binrpcFault(code int, reason string) fakeReply {
+	return fakeReply{fault: true, records: [][]byte{binrpcInt(code), binrpcString(reason)}}
+}
+
+// binrpcUint encodes v on the fewest bytes, none for 0.
+func binrpcUint(v uint32) []byte {
+	b := binary.BigEndian.AppendUint32(nil, v)
+	for len(b) > 0 && b[0] == 0 {
+		b = b[1:]
+	}
+	return b
+}
+
+func binrpcInt(v int) []byte {
+	value := binrpcUint(uint32(v))
+	return append([]byte{byte(len(value))<<4 | binrpcTypeInt}, value...)
+}
+
+func binrpcStringRecord(recordType byte, s string) []byte {
+	// strings are 0 terminated
+	data := append([]byte(s), 0)
+	if len(data) < 8 {
+		return append([]byte{byte(len(data))<<4 | recordType}, data...)
+	}
+	// the size flag tells the length of the value follows
+	size := binrpcUint(uint32(len(data)))
+	record := append([]byte{0x80 | byte(len(size))<<4 | recordType}, size...)
+	return append(record, data...)
+}
+
+func binrpcString(s string) []byte {
+	return binrpcStringRecord(binrpcTypeString, s)
+}
+
+// binrpcStruct encodes the members sorted by name.
+func binrpcStruct(members map[string][]byte) []byte {
+	names := make([]string, 0, len(members))
+	for name := range members {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	record := []byte{binrpcTypeStruct}
+	for _, name := range names {
+		record = append(record, binrpcStringRecord(binrpcTypeAVP, name)...)
+		record = append(record, members[name]...)
+	}
+	// a struct ends with a struct record of size 0 having the size flag set
+	return append(record, 0x80|binrpcTypeStruct)
+}
+
+// binrpcList encodes a struct repeating the member name, as Kamailio replies
+// with a list of entries.
+func binrpcList(name string, members ...[]byte) []byte {
+	record := []byte{binrpcTypeStruct}
+	for _, member := range members {
+		record = append(record, binrpcStringRecord(binrpcTypeAVP, name)...)
+		record = append(record, member...)
+	}
+	return append(record, 0x80|binrpcTypeStruct)
+}
+
+// binrpcPacket encodes a packet of the type, 1 for a reply and 3 for a fault.
+func binrpcPacket(packetType byte, cookie []byte, body []byte) []byte {
+	size := binrpcUint(uint32(len(body)))
+	if len(size) == 0 {
+		size = []byte{0}
+	}
+	packet := []byte{0xa1, packetType<<4 | byte(len(size)-1)<<2 | byte(len(cookie)-1)}
+	packet = append(packet, size...)
+	packet = append(packet, cookie...)
+	return append(packet, body...)
+}
+
+// readBinrpcRequest returns the strings of a request, and its cookie as sent.
+func readBinrpcRequest(r io.Reader) ([]string, []byte, error) {
+	fixed := make([]byte, 2)
+	if _, err := io.ReadFull(r, fixed); err != nil {
+		return nil, nil, err
+	}
+	if fixed[0] != 0xa1 {
+		return nil, nil, errors.New("not a BINRPC packet")
+	}
+	sizeLen, cookieLen := int(fixed[1]>>2&3)+1, int(fixed[1]&3)+1
+	header := make([]byte, sizeLen+cookieLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	body := make([]byte, readBinrpcUint(header[:sizeLen]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, err
+	}
+	args := make([]string, 0)
+	for len(body) > 0 {
+		if body[0]&0xf != binrpcTypeString {
+			return nil, nil, errors.New("not a string record")
+		}
+		size, n := int(body[0]>>4&7), 1
+		if body[0]&0x80 != 0 {
+			if len(body) < n+size {
+				return nil, nil, io.ErrUnexpectedEOF
+			}
+			size, n = readBinrpcUint(body[1:1+size]), 1+size
+		}
+		if len(body) < n+size || size == 0 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		// without the terminating 0
+		args = append(args, string(body[n:n+size-1]))
+		body = body[n+size:]
+	}
+	return args, header[sizeLen:], nil
+}
+
+func readBinrpcUint(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+// fakeKamailio answers the BINRPC commands like Kamailio would.
+type fakeKamailio struct {
+	mtx      sync.Mutex
+	reply    func(args []string) fakeReply
+	requests [][]string
+	// connections accepted by listen
+	connections int
+}
+
+func newFakeKamailio(reply func(args []string) fakeReply) *fakeKamailio {
+	return &fakeKamailio{reply: reply}
+}
+
+// commands returns the commands received, in order.
+func (k *fakeKamailio) commands() []string {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	commands := make([]string, 0, len(k.requests))
+	for _, args := range k.requests {
+		commands = append(commands, args[0])
+	}
+	return commands
+}
+
+// accepted returns the number of connections accepted by listen.
+func (k *fakeKamailio) accepted() int {
+	k.mtx.Lock()
+	defer k.mtx.Unlock()
+	return k.connections
+}
+
+// pipe returns a connection to the fake Kamailio.
+func (k *fakeKamailio) pipe() net.Conn {
+	client, server := net.Pipe()
+	go k.serve(server)
+	return client
+}
+
+// listen serves the fake Kamailio on a unix socket and returns its BINRPC URI.
+func (k *fakeKamailio) listen(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "kamailio_ctl")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			k.mtx.Lock()
+			k.connections++
+			k.mtx.Unlock()
+			go k.serve(conn)
+		}
+	}()
+	return "unix://" + path
+}
+
+// serve answers the requests read on conn until it's closed.
+func (k *fakeKamailio) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		args, cookie, err := readBinrpcRequest(conn)
+		if err != nil {
+			return
+		}
+		k.mtx.Lock()
+		k.requests = append(k.requests, args)
+		k.mtx.Unlock()
+		reply := k.reply(args)
+		if reply.hangUp {
+			return
+		}
+		var body []byte
+		for _, record := range reply.records {
+			body = append(body, record...)
+		}
+		packetType := byte(1)
+		if reply.fault {
+			packetType = 3
+		}
+		if _, err := conn.Write(binrpcPacket(packetType, cookie, body)); err != nil {
+			return
+		}
+	}
+}
+
+// collectSubCollector runs a scrape of c and returns the metrics it sent.
+func collectSubCollector(t *testing.T, c SubCollector, k *fakeKamailio) ([]*dto.Metric, error) {
+	conn := k.pipe()
+	defer conn.Close()
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	metrics := make([]*dto.Metric, 0)
+	go func() {
+		for m := range ch {
+			metric := &dto.Metric{}
+			if err := m.Write(metric); err != nil {
+				t.Errorf("Write: %v", err)
+			}
+			metrics = append(metrics, metric)
+		}
+		close(done)
+	}()
+	err := c.Collect(context.Background(), conn, ch)
+	close(ch)
+	<-done
+	return metrics, err
+}
+
+// gatherSubCollector runs a scrape of c through a registry and returns the
+// metric families by name.
+func gatherSubCollector(t *testing.T, c SubCollector, k *fakeKamailio) (map[string]*dto.MetricFamily, error) {
+	conn := k.pipe()
+	defer conn.Close()
+	scrape := &subCollectorScrape{c: c, conn: conn}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(scrape)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName, scrape.err
+}
+
+// subCollectorScrape is a prometheus.Collector running a SubCollector on conn.
+type subCollectorScrape struct {
+	c    SubCollector
+	conn net.Conn
+	err  error
+}
+
+func (s *subCollectorScrape) Describe(ch chan<- *prometheus.Desc) {
+	s.c.Describe(ch)
+}
+
+func (s *subCollectorScrape) Collect(ch chan<- prometheus.Metric) {
+	s.err = s.c.Collect(context.Background(), s.conn, ch)
+}
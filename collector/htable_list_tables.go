@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 
 	"github.com/go-kit/log"
@@ -42,7 +43,7 @@ type HtableListTablesCollector struct {
 }
 
 // NewHtableListTablesCollector returns a new Collector exposing htables status stats.
-func NewHtableListTablesCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewHtableListTablesCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &HtableListTablesCollector{
 		htableAutoExpire: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "htable", "auto_expire_seconds"),
@@ -65,7 +66,14 @@ func NewHtableListTablesCollector(config *KamailioCollectorConfig, logger log.Lo
 	}, nil
 }
 
-func (c *HtableListTablesCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *HtableListTablesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.htableAutoExpire
+	ch <- c.htableUpdateExpire
+	ch <- c.htableDmqReplicate
+	ch <- c.htableDBMode
+}
+
+func (c *HtableListTablesCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "htable.listTables")
 	if err != nil {
 		return err
@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 
 	"github.com/go-kit/log"
@@ -42,7 +43,7 @@ type HtableStatsCollector struct {
 }
 
 // NewHtableStatsCollector returns a new Collector exposing htable stats.
-func NewHtableStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewHtableStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &HtableStatsCollector{
 		htableSlot: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "htable", "slots_total"),
@@ -65,7 +66,14 @@ func NewHtableStatsCollector(config *KamailioCollectorConfig, logger log.Logger)
 	}, nil
 }
 
-func (c *HtableStatsCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *HtableStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.htableSlot
+	ch <- c.htableTotal
+	ch <- c.htableMin
+	ch <- c.htableMax
+}
+
+func (c *HtableStatsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "htable.stats")
 	if err != nil {
 		return err
@@ -0,0 +1,106 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("lcr.dump_gws", defaultEnabled, NewLcrDumpGwsCollector)
+}
+
+type lcrDumpGwsCollector struct {
+	gateways     *prometheus.Desc
+	gatewayState *prometheus.Desc
+	gatewayFlags *prometheus.Desc
+	logger       log.Logger
+	config       *KamailioCollectorConfig
+}
+
+// NewLcrDumpGwsCollector returns a new Collector exposing LCR gateways.
+func NewLcrDumpGwsCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &lcrDumpGwsCollector{
+		gateways: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "lcr", "gateways"),
+			"Number of gateways loaded per LCR instance",
+			[]string{"lcr_id"}, nil),
+		gatewayState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "lcr", "gateway_state"),
+			"State of the LCR gateway",
+			[]string{"lcr_id", "gw_id", "gw_name"}, nil),
+		gatewayFlags: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "lcr", "gateway_flags"),
+			"Flags of the LCR gateway",
+			[]string{"lcr_id", "gw_id", "gw_name"}, nil),
+		logger: logger,
+		config: config,
+	}, nil
+}
+
+func (c *lcrDumpGwsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.gateways
+	ch <- c.gatewayState
+	ch <- c.gatewayFlags
+}
+
+func (c *lcrDumpGwsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, "lcr.dump_gws")
+	if err != nil {
+		return err
+	}
+
+	gateways := make(map[int]int)
+	for _, record := range records {
+		items, _ := record.StructItems()
+		var lcrID, gwID, state, flags int
+		var gwName string
+		for _, item := range items {
+			switch item.Key {
+			case "lcr_id":
+				lcrID, _ = item.Value.Int()
+			case "gw_id":
+				gwID, _ = item.Value.Int()
+			case "gw_name":
+				gwName, _ = item.Value.String()
+			case "state":
+				state, _ = item.Value.Int()
+			case "flags":
+				flags, _ = item.Value.Int()
+			}
+		}
+		gateways[lcrID]++
+		slcrID := strconv.Itoa(lcrID)
+		sgwID := strconv.Itoa(gwID)
+		metricChannel <- prometheus.MustNewConstMetric(c.gatewayState, prometheus.GaugeValue, float64(state), slcrID, sgwID, gwName)
+		metricChannel <- prometheus.MustNewConstMetric(c.gatewayFlags, prometheus.GaugeValue, float64(flags), slcrID, sgwID, gwName)
+	}
+	for lcrID, count := range gateways {
+		metricChannel <- prometheus.MustNewConstMetric(c.gateways, prometheus.GaugeValue, float64(count), strconv.Itoa(lcrID))
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("msrp.cmaplist", defaultEnabled, NewMsrpCmaplistCollector)
+}
+
+type msrpCmaplistCollector struct {
+	sessions *prometheus.Desc
+	logger   log.Logger
+	config   *KamailioCollectorConfig
+}
+
+// NewMsrpCmaplistCollector returns a new Collector exposing MSRP relay sessions.
+func NewMsrpCmaplistCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &msrpCmaplistCollector{
+		sessions: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "msrp", "sessions"),
+			"Number of MSRP sessions in the connection map",
+			[]string{}, nil),
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (c *msrpCmaplistCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.sessions
+}
+
+func (c *msrpCmaplistCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, "msrp.cmaplist")
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		items, _ := record.StructItems()
+		var count int
+		var hasCount bool
+		var listed int
+		for _, item := range items {
+			switch item.Key {
+			case "CONCOUNT":
+				count, _ = item.Value.Int()
+				hasCount = true
+			case "CONLIST":
+				conns, _ := item.Value.StructItems()
+				listed = len(conns)
+			}
+		}
+		// older versions don't report the count, fall back to the list size
+		if !hasCount {
+			count = listed
+		}
+		metricChannel <- prometheus.MustNewConstMetric(c.sessions, prometheus.GaugeValue, float64(count))
+	}
+	return nil
+}
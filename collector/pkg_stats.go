@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 	"strconv"
 
@@ -54,7 +55,7 @@ type pkgStatsCollector struct {
 }
 
 // NewCoreStatsCollector returns a new Collector exposing core stats.
-func NewPkgStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewPkgStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &pkgStatsCollector{
 		used: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "pkgmem_used"),
@@ -90,7 +91,15 @@ func NewPkgStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (C
 	}, nil
 }
 
-func (c *pkgStatsCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *pkgStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.used
+	ch <- c.free
+	ch <- c.real
+	ch <- c.size
+	ch <- c.frags
+}
+
+func (c *pkgStatsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "pkg.stats")
 	if err != nil {
 		return err
@@ -0,0 +1,100 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Faults which usually go away by themselves, e.g. a module reporting it's busy.
+// The other faults, like a missing parameter or an unknown item, fail at once.
+var defaultRetryableFaultCodes = []int{503}
+
+const (
+	// attempts for a command returning a retryable fault, within the scrape deadline
+	faultRetries    = 2
+	faultRetryDelay = 50 * time.Millisecond
+)
+
+func newRPCFaults() *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: prometheus.BuildFQName(namespace, "exporter", "rpc_faults_total"),
+		Help: "kamailio_exporter: Faults returned by the BINRPC commands.",
+	}, []string{"method", "code"})
+}
+
+// the fault code and reason are only available from the error message, e.g.
+// "500 - Internal error", other errors may have a number in their message too
+var faultCodeRegex = regexp.MustCompile(`^([1-6][0-9][0-9]) - `)
+
+// faultCode returns the code of a fault returned by Kamailio.
+func faultCode(err error) (int, bool) {
+	// connection errors aren't faults, even when their message has a number in it
+	if isConnectionError(err) {
+		return 0, false
+	}
+	match := faultCodeRegex.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, false
+	}
+	code, err := strconv.Atoi(match[1])
+	if err != nil {
+		return 0, false
+	}
+	return code, true
+}
+
+func isRetryableFault(codes []int, code int) bool {
+	return slices.Contains(codes, code)
+}
+
+// parseFaultCodes parses the retryable fault codes, an empty list keeps the default ones.
+func parseFaultCodes(values *[]string) ([]int, error) {
+	codes := make([]int, 0)
+	if values == nil {
+		return defaultRetryableFaultCodes, nil
+	}
+	for _, value := range *values {
+		for _, entry := range strings.Split(value, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			code, err := strconv.Atoi(entry)
+			if err != nil || code < 100 || code > 699 {
+				return nil, fmt.Errorf("invalid fault code %q", entry)
+			}
+			codes = append(codes, code)
+		}
+	}
+	if len(codes) == 0 {
+		return defaultRetryableFaultCodes, nil
+	}
+	return codes, nil
+}
@@ -0,0 +1,162 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFaultCode(t *testing.T) {
+	tests := []struct {
+		err     error
+		code    int
+		isFault bool
+	}{
+		{errors.New("500 - Internal error"), 500, true},
+		{errors.New("503 - Busy"), 503, true},
+		{errors.New("404 - command dlg.list not found"), 404, true},
+		{fmt.Errorf("wrapped: %w", errors.New("500 - Internal error")), 0, false},
+		{errors.New("invalid type 129"), 0, false},
+		{errors.New("packet of 500 bytes is too short"), 0, false},
+		{errors.New("700 - Out of range"), 0, false},
+		{io.EOF, 0, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: errors.New("500 - connection reset")}, 0, false},
+	}
+	for _, test := range tests {
+		code, isFault := faultCode(test.err)
+		if code != test.code || isFault != test.isFault {
+			t.Errorf("faultCode(%q) = %d, %t, want %d, %t", test.err, code, isFault, test.code, test.isFault)
+		}
+	}
+}
+
+func TestIsRetryableFault(t *testing.T) {
+	tests := []struct {
+		codes     []int
+		code      int
+		retryable bool
+	}{
+		{defaultRetryableFaultCodes, 503, true},
+		{defaultRetryableFaultCodes, 500, false},
+		{defaultRetryableFaultCodes, 404, false},
+		{[]int{500, 503}, 500, true},
+		{[]int{500}, 503, false},
+	}
+	for _, test := range tests {
+		if retryable := isRetryableFault(test.codes, test.code); retryable != test.retryable {
+			t.Errorf("isRetryableFault(%d) with %v = %t, want %t", test.code, test.codes, retryable, test.retryable)
+		}
+	}
+}
+
+func TestParseFaultCodes(t *testing.T) {
+	tests := []struct {
+		values []string
+		codes  []int
+		fails  bool
+	}{
+		{nil, defaultRetryableFaultCodes, false},
+		{[]string{""}, defaultRetryableFaultCodes, false},
+		{[]string{"500"}, []int{500}, false},
+		{[]string{"500,503"}, []int{500, 503}, false},
+		{[]string{"500", " 503 "}, []int{500, 503}, false},
+		{[]string{"abc"}, nil, true},
+		{[]string{"99"}, nil, true},
+		{[]string{"700"}, nil, true},
+	}
+	for _, test := range tests {
+		var values *[]string
+		if test.values != nil {
+			values = &test.values
+		}
+		codes, err := parseFaultCodes(values)
+		if (err != nil) != test.fails {
+			t.Errorf("parseFaultCodes(%q) error = %v, want error %t", test.values, err, test.fails)
+			continue
+		}
+		if !slices.Equal(codes, test.codes) {
+			t.Errorf("parseFaultCodes(%q) = %v, want %v", test.values, codes, test.codes)
+		}
+	}
+}
+
+func TestGetRecordsRetriesFaults(t *testing.T) {
+	ok := binrpcReply(binrpcString("5.7.2"))
+	tests := []struct {
+		name     string
+		replies  []fakeReply
+		budget   time.Duration
+		requests int
+		faults   map[string]float64
+		err      bool
+	}{
+		{"retryable fault", []fakeReply{binrpcFault(503, "Busy"), ok}, time.Second, 2, map[string]float64{"503": 1}, false},
+		{"fault", []fakeReply{binrpcFault(500, "Internal error"), ok}, time.Second, 1, map[string]float64{"500": 1}, true},
+		{"retries exhausted", []fakeReply{binrpcFault(503, "Busy"), binrpcFault(503, "Busy"), binrpcFault(503, "Busy"), ok}, time.Second, 3, map[string]float64{"503": 3}, true},
+		// no time left to wait for the retry
+		{"scrape budget", []fakeReply{binrpcFault(503, "Busy"), ok}, faultRetryDelay / 2, 1, map[string]float64{"503": 1}, true},
+	}
+	for _, test := range tests {
+		var mtx sync.Mutex
+		replies := test.replies
+		k := newFakeKamailio(func(args []string) fakeReply {
+			mtx.Lock()
+			defer mtx.Unlock()
+			reply := replies[0]
+			replies = replies[1:]
+			return reply
+		})
+		conn := k.pipe()
+		sc := &scrapeConn{
+			Conn:                conn,
+			deadline:            time.Now().Add(test.budget),
+			rpcFaults:           newRPCFaults(),
+			retryableFaultCodes: defaultRetryableFaultCodes,
+		}
+		_, err := getRecords(sc, log.NewNopLogger(), "core.version")
+		conn.Close()
+		if (err != nil) != test.err {
+			t.Errorf("%s: got error %v, want one %t", test.name, err, test.err)
+		}
+		if got := len(k.commands()); got != test.requests {
+			t.Errorf("%s: sent %d requests, want %d", test.name, got, test.requests)
+		}
+		if got := testutil.CollectAndCount(sc.rpcFaults); got != len(test.faults) {
+			t.Errorf("%s: got %d fault codes, want %v", test.name, got, test.faults)
+		}
+		for code, want := range test.faults {
+			if got := testutil.ToFloat64(sc.rpcFaults.WithLabelValues("core.version", code)); got != want {
+				t.Errorf("%s: got %v faults %s, want %v", test.name, got, code, want)
+			}
+		}
+	}
+}
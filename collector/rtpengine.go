@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 	"strconv"
 
@@ -41,7 +42,7 @@ type rtpengineStatsCollector struct {
 }
 
 // NewCoreStatsCollector returns a new Collector exposing core stats.
-func NewRtpengineCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewRtpengineCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &rtpengineStatsCollector{
 		rtpengineEnabled: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "rtpengine_enabled"),
@@ -53,7 +54,11 @@ func NewRtpengineCollector(config *KamailioCollectorConfig, logger log.Logger) (
 	}, nil
 }
 
-func (c *rtpengineStatsCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *rtpengineStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.rtpengineEnabled
+}
+
+func (c *rtpengineStatsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	// fetch rtpengine disabled status and url
 	records, err := getRecords(conn, c.logger, "rtpengine.show", "all")
 	if err != nil {
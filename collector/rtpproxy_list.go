@@ -0,0 +1,96 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("rtpproxy.list", defaultEnabled, NewRtpproxyListCollector)
+}
+
+type rtpproxyListCollector struct {
+	instanceState *prometheus.Desc
+	logger        log.Logger
+	config        *KamailioCollectorConfig
+}
+
+// NewRtpproxyListCollector returns a new Collector exposing the state of the rtpproxy instances.
+func NewRtpproxyListCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &rtpproxyListCollector{
+		instanceState: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "rtpproxy", "instance_state"),
+			"Whether the rtpproxy instance is enabled: 1 enabled, 0 disabled.",
+			[]string{"url", "set"},
+			nil),
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (c *rtpproxyListCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.instanceState
+}
+
+func (c *rtpproxyListCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, "rtpproxy.list")
+	if err != nil {
+		return err
+	}
+
+	// one struct per instance of each set
+	for _, record := range records {
+		items, _ := record.StructItems()
+		var url, set string
+		disabled := 0
+		for _, item := range items {
+			switch item.Key {
+			case "url":
+				url, _ = item.Value.String()
+			case "setid", "set":
+				// the rtpproxy module names it "setid", "set" is accepted too
+				if setInt, err := item.Value.Int(); err == nil {
+					set = strconv.Itoa(setInt)
+				}
+			case "disabled":
+				disabled, _ = item.Value.Int()
+			}
+		}
+		if url == "" {
+			level.Debug(c.logger).Log("msg", "Skipping rtpproxy instance without url")
+			continue
+		}
+		state := 1
+		if disabled != 0 {
+			state = 0
+		}
+		metricChannel <- prometheus.MustNewConstMetric(c.instanceState, prometheus.GaugeValue, float64(state), url, set)
+	}
+	return nil
+}
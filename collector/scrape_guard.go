@@ -0,0 +1,184 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Modes of attaching the collection time to the metrics.
+const (
+	TimestampsAuto   = "auto"
+	TimestampsAlways = "always"
+	TimestampsNever  = "never"
+)
+
+// scrapeGuard replays the previous metrics to scrapes arriving faster than the interval.
+type scrapeGuard struct {
+	mtx           sync.Mutex
+	throttledDesc *prometheus.Desc
+	interval      time.Duration
+	timestamps    string
+	lastScrape    time.Time
+	metrics       []prometheus.Metric
+	throttled     int
+}
+
+// newScrapeGuard returns a guard counting the throttled scrapes with
+// throttledDesc, which is in the namespace of its collector.
+func newScrapeGuard(throttledDesc *prometheus.Desc, interval time.Duration, timestamps string) *scrapeGuard {
+	return &scrapeGuard{
+		throttledDesc: throttledDesc,
+		interval:      interval,
+		timestamps:    timestamps,
+	}
+}
+
+// stamp attaches the collection time to m, in the "always" mode or, in the
+// "auto" mode, when m is replayed.
+func (g *scrapeGuard) stamp(m prometheus.Metric, collected time.Time, replayed bool) prometheus.Metric {
+	if g.timestamps == TimestampsAlways || (replayed && g.timestamps == TimestampsAuto) {
+		return prometheus.NewMetricWithTimestamp(collected, m)
+	}
+	return m
+}
+
+// Collect calls collect, unless it already ran successfully during the
+// interval. The metrics of the previous run are sent instead then. A run
+// which collect reports as failed, e.g. Kamailio was down or a collector
+// failed, isn't replayed. Concurrent scrapes wait for the running one and get
+// its result, unless it failed.
+func (g *scrapeGuard) Collect(ch chan<- prometheus.Metric, collect func(chan<- prometheus.Metric) bool) {
+	if g.interval <= 0 {
+		if g.timestamps != TimestampsAlways {
+			collect(ch)
+			return
+		}
+		collected := time.Now()
+		forward := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		go func() {
+			for m := range forward {
+				ch <- g.stamp(m, collected, false)
+			}
+			close(done)
+		}()
+		collect(forward)
+		close(forward)
+		<-done
+		return
+	}
+	g.mtx.Lock()
+	defer g.mtx.Unlock()
+
+	if g.metrics != nil && time.Since(g.lastScrape) < g.interval {
+		g.throttled++
+		for _, m := range g.metrics {
+			ch <- g.stamp(m, g.lastScrape, true)
+		}
+	} else {
+		collected := time.Now()
+		metrics := make([]prometheus.Metric, 0, len(g.metrics))
+		forward := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		go func() {
+			for m := range forward {
+				metrics = append(metrics, m)
+				ch <- g.stamp(m, collected, false)
+			}
+			close(done)
+		}()
+		failed := collect(forward)
+		close(forward)
+		<-done
+		// a transient failure must not be replayed for the whole interval
+		g.metrics = nil
+		if !failed {
+			g.metrics = metrics
+			g.lastScrape = collected
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(g.throttledDesc, prometheus.CounterValue, float64(g.throttled))
+}
+
+// maxProbeGuards bounds the targets whose last result is kept, the probes of
+// further targets aren't throttled.
+const maxProbeGuards = 1000
+
+// probeGuards keeps a guard per probed target, as long as its last result may
+// be replayed.
+type probeGuards struct {
+	mtx           sync.Mutex
+	throttledDesc *prometheus.Desc
+	interval      time.Duration
+	timestamps    string
+	guards        map[string]*scrapeGuard
+	lastEvict     time.Time
+}
+
+func newProbeGuards(throttledDesc *prometheus.Desc, interval time.Duration, timestamps string) *probeGuards {
+	return &probeGuards{
+		throttledDesc: throttledDesc,
+		interval:      interval,
+		timestamps:    timestamps,
+		guards:        make(map[string]*scrapeGuard),
+	}
+}
+
+// get returns the guard of a target. Without interval, nothing is replayed and
+// the guard isn't kept.
+func (p *probeGuards) get(target string) *scrapeGuard {
+	if p.interval <= 0 {
+		return newScrapeGuard(p.throttledDesc, p.interval, p.timestamps)
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if g, ok := p.guards[target]; ok {
+		return g
+	}
+	if time.Since(p.lastEvict) >= p.interval || len(p.guards) >= maxProbeGuards {
+		p.evictIdle()
+	}
+	g := newScrapeGuard(p.throttledDesc, p.interval, p.timestamps)
+	if len(p.guards) < maxProbeGuards {
+		p.guards[target] = g
+	}
+	return g
+}
+
+// evictIdle removes the guards whose last result can't be replayed anymore.
+func (p *probeGuards) evictIdle() {
+	p.lastEvict = time.Now()
+	for target, g := range p.guards {
+		// a guard which is collecting is busy, not idle
+		if !g.mtx.TryLock() {
+			continue
+		}
+		if time.Since(g.lastScrape) >= p.interval {
+			delete(p.guards, target)
+		}
+		g.mtx.Unlock()
+	}
+}
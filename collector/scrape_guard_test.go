@@ -0,0 +1,134 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stubCollector returns err from each scrape.
+type stubCollector struct {
+	err error
+}
+
+func (c stubCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c stubCollector) Collect(ctx context.Context, conn net.Conn, ch chan<- prometheus.Metric) error {
+	return c.err
+}
+
+// collectAll runs the guard and returns the metrics it sent.
+func collectAll(g *scrapeGuard, collect func(chan<- prometheus.Metric) bool) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	metrics := make([]prometheus.Metric, 0)
+	go func() {
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+	g.Collect(ch, collect)
+	close(ch)
+	<-done
+	return metrics
+}
+
+func TestScrapeGuardReplay(t *testing.T) {
+	descs := newExporterDescs(defaultNamespace)
+	tests := []struct {
+		name  string
+		err   error
+		calls int
+	}{
+		// e.g. core.ps without --collector.fds
+		{"no data", ErrNoData, 1},
+		{"success", nil, 1},
+		{"fault", errors.New("500 - Internal error"), 2},
+	}
+	for _, test := range tests {
+		g := newScrapeGuard(descs.throttled, time.Minute, TimestampsAuto)
+		calls := 0
+		collect := func(ch chan<- prometheus.Metric) bool {
+			calls++
+			status, _ := execute(context.Background(), "core.ps", stubCollector{test.err}, nil, ch, descs, log.NewNopLogger())
+			return status.Status == statusError
+		}
+		first := collectAll(g, collect)
+		second := collectAll(g, collect)
+		if calls != test.calls {
+			t.Errorf("%s: collected %d times, want %d", test.name, calls, test.calls)
+		}
+		if len(second) != len(first) {
+			t.Errorf("%s: second scrape sent %d metrics, want %d", test.name, len(second), len(first))
+		}
+	}
+}
+
+func TestScrapeGuardDisabled(t *testing.T) {
+	g := newScrapeGuard(newExporterDescs(defaultNamespace).throttled, 0, TimestampsAuto)
+	calls := 0
+	collect := func(ch chan<- prometheus.Metric) bool {
+		calls++
+		return false
+	}
+	collectAll(g, collect)
+	collectAll(g, collect)
+	if calls != 2 {
+		t.Errorf("collected %d times, want 2", calls)
+	}
+}
+
+func TestProbeGuards(t *testing.T) {
+	throttled := newExporterDescs(defaultNamespace).throttled
+	p := newProbeGuards(throttled, 0, TimestampsAuto)
+	if p.get("tcp://a:2046") == p.get("tcp://a:2046") || len(p.guards) != 0 {
+		t.Errorf("guards are kept without interval")
+	}
+
+	p = newProbeGuards(throttled, time.Minute, TimestampsAuto)
+	if p.get("tcp://a:2046") != p.get("tcp://a:2046") {
+		t.Errorf("a target got two guards")
+	}
+	for i := 0; i < 2*maxProbeGuards; i++ {
+		p.get(fmt.Sprintf("tcp://10.0.%d.%d:2046", i/256, i%256))
+	}
+	if len(p.guards) > maxProbeGuards {
+		t.Errorf("%d guards are kept, want at most %d", len(p.guards), maxProbeGuards)
+	}
+
+	p = newProbeGuards(throttled, time.Millisecond, TimestampsAuto)
+	p.get("tcp://a:2046")
+	time.Sleep(2 * time.Millisecond)
+	p.get("tcp://b:2046")
+	if _, ok := p.guards["tcp://a:2046"]; ok {
+		t.Errorf("the idle guard wasn't evicted")
+	}
+}
@@ -0,0 +1,77 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	registerCollector("sipcapture.status", defaultEnabled, NewSipcaptureStatusCollector)
+}
+
+type sipcaptureStatusCollector struct {
+	enabled *prometheus.Desc
+	logger  log.Logger
+	config  *KamailioCollectorConfig
+}
+
+// NewSipcaptureStatusCollector returns a new Collector exposing whether the capture is enabled.
+func NewSipcaptureStatusCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &sipcaptureStatusCollector{
+		enabled: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "sipcapture", "enabled"),
+			"Whether sipcapture stores the captured packets",
+			[]string{}, nil),
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (c *sipcaptureStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.enabled
+}
+
+func (c *sipcaptureStatusCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	// "check" only reads the status, "on" and "off" change it
+	records, err := getRecords(conn, c.logger, "sipcapture.status", "check")
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return ErrNoData
+	}
+
+	// the reply is a sentence, e.g. "Sipcapture enabled."
+	status, _ := records[0].String()
+	var enabled float64
+	if strings.Contains(strings.ToLower(status), "enabled") {
+		enabled = 1
+	}
+	metricChannel <- prometheus.MustNewConstMetric(c.enabled, prometheus.GaugeValue, enabled)
+	return nil
+}
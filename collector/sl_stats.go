@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 
 	"github.com/go-kit/log"
@@ -39,7 +40,7 @@ type slStatsCollector struct {
 }
 
 // NewCoreStatsCollector returns a new Collector exposing core stats.
-func NewSlStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewSlStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &slStatsCollector{
 		codes:  prometheus.NewDesc(prometheus.BuildFQName(namespace, "sl_stats", "codes_total"), "Per-code counters.", []string{"code"}, nil),
 		config: config,
@@ -47,7 +48,11 @@ func NewSlStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (Co
 	}, nil
 }
 
-func (c *slStatsCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *slStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.codes
+}
+
+func (c *slStatsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "sl.stats")
 	if err != nil {
 		return err
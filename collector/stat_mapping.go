@@ -0,0 +1,223 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+// this is used to validate the metric and label names produced by the mapping rules
+var (
+	metricNameRegex = regexp.MustCompile("^[a-zA-Z_:][a-zA-Z0-9_:]*$")
+	labelNameRegex  = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*$")
+	// "$1", "${1}" or "${name}" in a template
+	templateRefRegex = regexp.MustCompile(`\$(?:\{(\w+)\}|(\w+))`)
+)
+
+// statMappingRule turns the statistics whose name matches the regex into a
+// labeled metric. The name and the label values are templates expanded with
+// the groups of the match.
+type statMappingRule struct {
+	Match  string            `yaml:"match"`
+	Name   string            `yaml:"name"`
+	Labels map[string]string `yaml:"labels"`
+	Type   string            `yaml:"type"`
+
+	regex     *regexp.Regexp
+	labelKeys []string
+	valueType prometheus.ValueType
+}
+
+// loadStatMapping reads and validates the rules of the mapping file.
+func loadStatMapping(path string) ([]*statMappingRule, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]*statMappingRule, 0)
+	if err := yaml.UnmarshalStrict(content, &rules); err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	for i, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("invalid rule %d of %s: %w", i+1, path, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *statMappingRule) compile() error {
+	regex, err := regexp.Compile(r.Match)
+	if err != nil {
+		return fmt.Errorf("invalid match: %w", err)
+	}
+	r.regex = regex
+	if err := r.checkTemplate(r.Name); err != nil {
+		return err
+	}
+	// expand the name as if every group matched, to validate it
+	sample := make([]string, regex.NumSubexp()+1)
+	for i := range sample {
+		sample[i] = "x"
+	}
+	if name := prometheus.BuildFQName(namespace, "", r.expand(r.Name, sample)); !metricNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid metric name %q", r.Name)
+	}
+	for key, value := range r.Labels {
+		if !labelNameRegex.MatchString(key) {
+			return fmt.Errorf("invalid label name %q", key)
+		}
+		if err := r.checkTemplate(value); err != nil {
+			return err
+		}
+		r.labelKeys = append(r.labelKeys, key)
+	}
+	sort.Strings(r.labelKeys)
+	switch r.Type {
+	case "counter":
+		r.valueType = prometheus.CounterValue
+	case "gauge":
+		r.valueType = prometheus.GaugeValue
+	case "":
+		// same deduction as the scripted metrics
+		r.valueType = prometheus.GaugeValue
+		if strings.HasSuffix(r.Name, "_total") || strings.HasSuffix(r.Name, "_seconds") || strings.HasSuffix(r.Name, "_bytes") {
+			r.valueType = prometheus.CounterValue
+		}
+	default:
+		return fmt.Errorf("invalid type %q, expected counter or gauge", r.Type)
+	}
+	return nil
+}
+
+// checkTemplate fails when the template refers to a group the regex doesn't have.
+func (r *statMappingRule) checkTemplate(template string) error {
+	for _, ref := range templateRefRegex.FindAllStringSubmatch(template, -1) {
+		name := ref[1] + ref[2]
+		if index, err := strconv.Atoi(name); err == nil {
+			if index > r.regex.NumSubexp() {
+				return fmt.Errorf("template %q refers to group %d, the match has %d", template, index, r.regex.NumSubexp())
+			}
+		} else if r.regex.SubexpIndex(name) < 0 {
+			return fmt.Errorf("template %q refers to unknown group %q", template, name)
+		}
+	}
+	return nil
+}
+
+func (r *statMappingRule) expand(template string, match []string) string {
+	indexes := make([]int, 0, 2*len(match))
+	for range match {
+		indexes = append(indexes, 0, 0)
+	}
+	// regexp.Expand takes the match as indexes into its source
+	source := ""
+	for i, group := range match {
+		indexes[2*i] = len(source)
+		source += group
+		indexes[2*i+1] = len(source)
+	}
+	return string(r.regex.ExpandString(nil, template, source, indexes))
+}
+
+// mappedSample is the sum of the statistics mapped to the same series.
+type mappedSample struct {
+	rule        *statMappingRule
+	name        string
+	labelValues []string
+	value       float64
+}
+
+// convertMappedStats exports the statistics matching a rule, the first one
+// which matches, and removes them from the map so they aren't exported again
+// as scripted metrics. The statistics mapped to the same series are summed.
+func (c *StatsFetchCollector) convertMappedStats(completeStatMap map[string]string, metricChannel chan<- prometheus.Metric) {
+	rules, logger := c.mapping, c.logger
+	if len(rules) == 0 {
+		return
+	}
+	samples := make(map[string]*mappedSample)
+	for k, valueAsString := range completeStatMap {
+		for _, rule := range rules {
+			match := rule.regex.FindStringSubmatch(k)
+			if match == nil {
+				continue
+			}
+			delete(completeStatMap, k)
+			value, err := strconv.ParseFloat(valueAsString, 64)
+			if err != nil {
+				level.Debug(logger).Log("msg", "Invalid mapped statistic", "stat", k, "value", valueAsString)
+				break
+			}
+			// a counter can't go below zero, skip it rather than break rate()
+			if rule.valueType == prometheus.CounterValue && value < 0 {
+				break
+			}
+			name := prometheus.BuildFQName(c.namespace, "", rule.expand(rule.Name, match))
+			labelValues := make([]string, 0, len(rule.labelKeys))
+			for _, key := range rule.labelKeys {
+				labelValues = append(labelValues, rule.expand(rule.Labels[key], match))
+			}
+			id := name + "\xff" + strings.Join(labelValues, "\xff")
+			if sample, ok := samples[id]; ok {
+				sample.value += value
+			} else {
+				samples[id] = &mappedSample{rule: rule, name: name, labelValues: labelValues, value: value}
+			}
+			break
+		}
+	}
+
+	ids := make([]string, 0, len(samples))
+	for id := range samples {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	// a metric must keep the same labels whatever rule produced it
+	labelKeys := make(map[string][]string)
+	for _, id := range ids {
+		sample := samples[id]
+		keys, ok := labelKeys[sample.name]
+		if !ok {
+			labelKeys[sample.name] = sample.rule.labelKeys
+		} else if strings.Join(keys, ",") != strings.Join(sample.rule.labelKeys, ",") {
+			level.Warn(logger).Log("msg", "Mapped statistics with different labels, skipping", "metric", sample.name)
+			continue
+		}
+		desc := prometheus.NewDesc(sample.name, "Statistics mapped by the rules of the mapping file", sample.rule.labelKeys, nil)
+		metric, err := prometheus.NewConstMetric(desc, sample.rule.valueType, roundFloat(sample.value, c.floatPrecision), sample.labelValues...)
+		if err != nil {
+			level.Debug(logger).Log("msg", "Cannot produce mapped metric", "metric", sample.name, "err", err)
+			continue
+		}
+		metricChannel <- metric
+	}
+}
@@ -22,11 +22,18 @@
 package collector
 
 import (
+	"context"
+	"fmt"
+	"math"
 	"net"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -34,6 +41,15 @@ func init() {
 	registerCollector("stats.fetch", defaultEnabled, NewStatsFetchCollector)
 }
 
+// this is used to validate the statistics group names given on the command line
+var statGroupRegex = regexp.MustCompile("^[A-Za-z0-9_-]+$")
+
+// this is used to validate the SIP response codes given on the command line
+var responseCodeRegex = regexp.MustCompile("^[1-6][0-9][0-9]$")
+
+// prefix of the scripted statistics counting the SIP responses by code
+const responseCodeStatPrefix = "script.sip_responses_"
+
 type StatsFetchCollector struct {
 	coreRequestTotal    *prometheus.Desc
 	coreRcvRequestTotal *prometheus.Desc
@@ -54,12 +70,48 @@ type StatsFetchCollector struct {
 	tmx                 *prometheus.Desc
 	tmxRplTotal         *prometheus.Desc
 	dialog              *prometheus.Desc
-	logger              log.Logger
-	config              *KamailioCollectorConfig
+	dialogTerminated    *prometheus.Desc
+	tsiloTotal          *prometheus.Desc
+	tsiloStored         *prometheus.Desc
+	usrlocUsers         *prometheus.Desc
+	usrlocContacts      *prometheus.Desc
+	usrlocExpired       *prometheus.Desc
+	sipResponsesTotal   *prometheus.Desc
+	groups              []string
+	responseCodes       []string
+	mapping             []*statMappingRule
+	// namespace of the scripted and mapped metrics
+	namespace string
+	// number of decimals kept for statistics values, -1 keeps them all
+	floatPrecision int
+	logger         log.Logger
+	config         *KamailioCollectorConfig
+	// the requested groups already reported empty, warned about only once
+	mtx         sync.Mutex
+	emptyGroups map[string]bool
 }
 
 // NewStatsFetchCollector returns a new Collector exposing core stats.
-func NewStatsFetchCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewStatsFetchCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	groups, err := parseStatGroups(config.StatsFetch.Groups)
+	if err != nil {
+		return nil, err
+	}
+	responseCodes, err := parseResponseCodes(config.StatsFetch.ResponseCodes)
+	if err != nil {
+		return nil, err
+	}
+	var mapping []*statMappingRule
+	if config.StatsFetch.MappingFile != nil && *config.StatsFetch.MappingFile != "" {
+		mapping, err = loadStatMapping(*config.StatsFetch.MappingFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	floatPrecision := -1
+	if config.StatsFetch.FloatPrecision != nil {
+		floatPrecision = *config.StatsFetch.FloatPrecision
+	}
 	return &StatsFetchCollector{
 		coreRequestTotal: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "", "core_request_total"),
@@ -155,13 +207,141 @@ func NewStatsFetchCollector(config *KamailioCollectorConfig, logger log.Logger)
 			prometheus.BuildFQName(namespace, "", "dialog"),
 			"Ongoing Dialogs",
 			[]string{"type"}, nil),
-		logger: logger,
-		config: config,
+
+		dialogTerminated: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "dialog_terminated_total"),
+			"Dialogs terminated otherwise than by a BYE, by reason",
+			[]string{"reason"}, nil),
+
+		tsiloTotal: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "tsilo_total"),
+			"Tsilo counters",
+			[]string{"type"}, nil),
+
+		tsiloStored: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "tsilo_stored"),
+			"Currently stored tsilo entries",
+			[]string{"type"}, nil),
+
+		usrlocUsers: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "usrloc_registered_users"),
+			"Registered users",
+			[]string{}, nil),
+
+		usrlocContacts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "usrloc_contacts"),
+			"Registered contacts by location table",
+			[]string{"table", "scope"}, nil),
+
+		usrlocExpired: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "usrloc_expired_contacts_total"),
+			"Expired contacts removed from the location table",
+			[]string{"table"}, nil),
+
+		sipResponsesTotal: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "sip_responses_total"),
+			"SIP responses by code, counted by the script",
+			[]string{"code"}, nil),
+		groups:         groups,
+		responseCodes:  responseCodes,
+		mapping:        mapping,
+		namespace:      namespace,
+		floatPrecision: floatPrecision,
+		logger:         logger,
+		config:         config,
 	}, nil
 }
 
-func (c *StatsFetchCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
-	records, err := getRecords(conn, c.logger, "stats.fetch", "all")
+// parseResponseCodes validates the SIP response codes to export.
+func parseResponseCodes(values *[]string) ([]string, error) {
+	codes := make([]string, 0)
+	if values == nil {
+		return codes, nil
+	}
+	for _, value := range *values {
+		for _, code := range strings.Split(value, ",") {
+			code = strings.TrimSpace(code)
+			if code == "" {
+				continue
+			}
+			if !responseCodeRegex.MatchString(code) {
+				return nil, fmt.Errorf("invalid SIP response code %q", code)
+			}
+			if !slices.Contains(codes, code) {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes, nil
+}
+
+// parseStatGroups validates the requested statistics groups.
+// An empty list means all the statistics are fetched.
+func parseStatGroups(values *[]string) ([]string, error) {
+	groups := make([]string, 0)
+	if values == nil {
+		return groups, nil
+	}
+	for _, value := range *values {
+		for _, group := range strings.Split(value, ",") {
+			group = strings.TrimSuffix(strings.TrimSpace(group), ":")
+			if group == "" {
+				continue
+			}
+			if !statGroupRegex.MatchString(group) {
+				return nil, fmt.Errorf("invalid statistics group %q", group)
+			}
+			groups = append(groups, group)
+		}
+	}
+	return groups, nil
+}
+
+// Describe sends the descriptors of the known statistics. The scripted and
+// mapped ones are discovered by the scrapes, they aren't described.
+func (c *StatsFetchCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.coreRequestTotal
+	ch <- c.coreRcvRequestTotal
+	ch <- c.coreReplyTotal
+	ch <- c.coreRcvReplyTotal
+	ch <- c.shmemBytes
+	ch <- c.shmemFragments
+	ch <- c.dnsFailed
+	ch <- c.badURI
+	ch <- c.badMsgHdr
+	ch <- c.slReplyTotal
+	ch <- c.slTypeTotal
+	ch <- c.tcpTotal
+	ch <- c.tcpConnections
+	ch <- c.tcpWritequeue
+	ch <- c.tmxCodeTotal
+	ch <- c.tmxTypeTotal
+	ch <- c.tmx
+	ch <- c.tmxRplTotal
+	ch <- c.dialog
+	ch <- c.dialogTerminated
+	ch <- c.tsiloTotal
+	ch <- c.tsiloStored
+	ch <- c.usrlocUsers
+	ch <- c.usrlocContacts
+	ch <- c.usrlocExpired
+	ch <- c.sipResponsesTotal
+}
+
+func (c *StatsFetchCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	// request only the configured groups, using the "group:" syntax
+	args := []string{"stats.fetch"}
+	if len(c.groups) == 0 {
+		args = append(args, "all")
+	}
+	for _, group := range c.groups {
+		args = append(args, group+":")
+	}
+	// always discover the scripted statistics, whatever registered them
+	if len(c.groups) > 0 && !slices.Contains(c.groups, "script") {
+		args = append(args, "script:")
+	}
+	records, err := getRecords(conn, c.logger, args...)
 	if err != nil {
 		return err
 	}
@@ -173,147 +353,231 @@ func (c *StatsFetchCollector) Update(conn net.Conn, metricChannel chan<- prometh
 		value, _ := item.Value.String()
 		completeStatMap[item.Key] = value
 	}
+	c.warnEmptyGroups(completeStatMap)
 	// and produce various prometheus.Metric for well-known stats
 	produceMetrics(completeStatMap, c, metricChannel)
+	// kamailio_sip_responses_total, taken out of the scripted stats
+	c.convertResponseCodes(completeStatMap, metricChannel)
+	// the statistics matching the rules of the mapping file
+	c.convertMappedStats(completeStatMap, metricChannel)
 	// produce prometheus.Metric objects for scripted stats (if any)
-	convertScriptedMetrics(completeStatMap, metricChannel)
+	c.convertScriptedMetrics(completeStatMap, metricChannel)
 
 	return nil
 }
 
+// warn about the requested groups for which kamailio returned no statistic,
+// once per group until it returns statistics again
+func (c *StatsFetchCollector) warnEmptyGroups(completeStatMap map[string]string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	for _, group := range c.groups {
+		found := false
+		for k := range completeStatMap {
+			if strings.HasPrefix(k, group+".") {
+				found = true
+				break
+			}
+		}
+		switch {
+		case found:
+			delete(c.emptyGroups, group)
+		case c.emptyGroups[group]:
+			level.Debug(c.logger).Log("msg", "Statistics group returned nothing", "group", group)
+		default:
+			level.Warn(c.logger).Log("msg", "Statistics group returned nothing", "group", group)
+			if c.emptyGroups == nil {
+				c.emptyGroups = make(map[string]bool)
+			}
+			c.emptyGroups[group] = true
+		}
+	}
+}
+
 // produce a series of prometheus.Metric values by converting "well-known" prometheus stats
 func produceMetrics(completeStatMap map[string]string, c *StatsFetchCollector, metricChannel chan<- prometheus.Metric) {
 	// kamailio_core_request_total
-	convertStatToMetric(completeStatMap, "core.drop_requests", "drop", c.coreRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.err_requests", "err", c.coreRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.fwd_requests", "fwd", c.coreRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests", "rcv", c.coreRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.drop_requests", "drop", c.coreRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.err_requests", "err", c.coreRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.fwd_requests", "fwd", c.coreRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests", "rcv", c.coreRequestTotal, metricChannel, prometheus.CounterValue)
 
 	// kamailio_core_rcv_request_total
-	convertStatToMetric(completeStatMap, "core.rcv_requests_ack", "ack", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_bye", "bye", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_cancel", "cancel", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_info", "info", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_invite", "invite", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_message", "message", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_notify", "notify", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_options", "options", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_prack", "prack", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_publish", "publish", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_refer", "refer", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_register", "register", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_subscribe", "subscribe", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_requests_update", "update", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.unsupported_methods", "unsupported", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_ack", "ack", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_bye", "bye", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_cancel", "cancel", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_info", "info", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_invite", "invite", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_message", "message", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_notify", "notify", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_options", "options", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_prack", "prack", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_publish", "publish", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_refer", "refer", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_register", "register", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_subscribe", "subscribe", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_requests_update", "update", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.unsupported_methods", "unsupported", c.coreRcvRequestTotal, metricChannel, prometheus.CounterValue)
 
 	// kamailio_core_reply_total
-	convertStatToMetric(completeStatMap, "core.drop_replies", "drop", c.coreReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.err_replies", "err", c.coreReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.fwd_replies", "fwd", c.coreReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies", "rcv", c.coreReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.drop_replies", "drop", c.coreReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.err_replies", "err", c.coreReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.fwd_replies", "fwd", c.coreReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies", "rcv", c.coreReplyTotal, metricChannel, prometheus.CounterValue)
 
 	// kamailio_core_rcv_reply_total
-	convertStatToMetric(completeStatMap, "core.rcv_replies_18x", "18x", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_1xx", "1xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_2xx", "2xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_3xx", "3xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_401", "401", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_404", "404", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_407", "407", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_408", "408", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_480", "480", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_486", "486", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_4xx", "4xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_5xx", "5xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.rcv_replies_6xx", "6xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_18x", "18x", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_1xx", "1xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_2xx", "2xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_3xx", "3xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_401", "401", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_404", "404", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_407", "407", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_408", "408", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_480", "480", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_486", "486", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_4xx", "4xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_5xx", "5xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.rcv_replies_6xx", "6xx", c.coreRcvReplyTotal, metricChannel, prometheus.CounterValue)
 
 	// kamailio_shm_bytes
-	convertStatToMetric(completeStatMap, "shmem.free_size", "free", c.shmemBytes, metricChannel, prometheus.GaugeValue)
-	convertStatToMetric(completeStatMap, "shmem.max_used_size", "max_used", c.shmemBytes, metricChannel, prometheus.GaugeValue)
-	convertStatToMetric(completeStatMap, "shmem.real_used_size", "real_used", c.shmemBytes, metricChannel, prometheus.GaugeValue)
-	convertStatToMetric(completeStatMap, "shmem.total_size", "total", c.shmemBytes, metricChannel, prometheus.GaugeValue)
-	convertStatToMetric(completeStatMap, "shmem.used_size", "used", c.shmemBytes, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "shmem.free_size", "free", c.shmemBytes, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "shmem.max_used_size", "max_used", c.shmemBytes, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "shmem.real_used_size", "real_used", c.shmemBytes, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "shmem.total_size", "total", c.shmemBytes, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "shmem.used_size", "used", c.shmemBytes, metricChannel, prometheus.GaugeValue)
 
-	convertStatToMetric(completeStatMap, "shmem.fragments", "", c.shmemFragments, metricChannel, prometheus.GaugeValue)
-	convertStatToMetric(completeStatMap, "dns.failed_dns_request", "", c.dnsFailed, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.bad_URIs_rcvd", "", c.badURI, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "core.bad_msg_hdr", "", c.badMsgHdr, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "shmem.fragments", "", c.shmemFragments, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "dns.failed_dns_request", "", c.dnsFailed, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.bad_URIs_rcvd", "", c.badURI, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "core.bad_msg_hdr", "", c.badMsgHdr, metricChannel, prometheus.CounterValue)
 
 	// kamailio_sl_reply_total
-	convertStatToMetric(completeStatMap, "sl.1xx_replies", "1xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.200_replies", "200", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.202_replies", "202", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.2xx_replies", "2xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.300_replies", "300", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.301_replies", "301", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.302_replies", "302", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.3xx_replies", "3xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.400_replies", "400", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.401_replies", "401", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.403_replies", "403", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.404_replies", "404", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.407_replies", "407", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.408_replies", "408", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.483_replies", "483", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.4xx_replies", "4xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.500_replies", "500", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.5xx_replies", "5xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.6xx_replies", "6xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.1xx_replies", "1xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.200_replies", "200", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.202_replies", "202", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.2xx_replies", "2xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.300_replies", "300", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.301_replies", "301", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.302_replies", "302", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.3xx_replies", "3xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.400_replies", "400", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.401_replies", "401", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.403_replies", "403", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.404_replies", "404", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.407_replies", "407", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.408_replies", "408", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.483_replies", "483", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.4xx_replies", "4xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.500_replies", "500", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.5xx_replies", "5xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.6xx_replies", "6xx", c.slReplyTotal, metricChannel, prometheus.CounterValue)
 
 	// kamailio_sl_type_total
-	convertStatToMetric(completeStatMap, "sl.failures", "failure", c.slTypeTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.received_ACKs", "received_ack", c.slTypeTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.sent_err_replies", "sent_err_reply", c.slTypeTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.sent_replies", "sent_reply", c.slTypeTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "sl.xxx_replies", "xxx_reply", c.slTypeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.failures", "failure", c.slTypeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.received_ACKs", "received_ack", c.slTypeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.sent_err_replies", "sent_err_reply", c.slTypeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.sent_replies", "sent_reply", c.slTypeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "sl.xxx_replies", "xxx_reply", c.slTypeTotal, metricChannel, prometheus.CounterValue)
 
 	// kamailio_tcp_total
-	convertStatToMetric(completeStatMap, "tcp.con_reset", "con_reset", c.tcpTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tcp.con_timeout", "con_timeout", c.tcpTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tcp.connect_failed", "connect_failed", c.tcpTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tcp.connect_success", "connect_success", c.tcpTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tcp.established", "established", c.tcpTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tcp.local_reject", "local_reject", c.tcpTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tcp.passive_open", "passive_open", c.tcpTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tcp.send_timeout", "send_timeout", c.tcpTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tcp.sendq_full", "sendq_full", c.tcpTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tcp.con_reset", "con_reset", c.tcpTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tcp.con_timeout", "con_timeout", c.tcpTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tcp.connect_failed", "connect_failed", c.tcpTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tcp.connect_success", "connect_success", c.tcpTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tcp.established", "established", c.tcpTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tcp.local_reject", "local_reject", c.tcpTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tcp.passive_open", "passive_open", c.tcpTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tcp.send_timeout", "send_timeout", c.tcpTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tcp.sendq_full", "sendq_full", c.tcpTotal, metricChannel, prometheus.CounterValue)
 	// kamailio_tcp_connections
-	convertStatToMetric(completeStatMap, "tcp.current_opened_connections", "", c.tcpConnections, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "tcp.current_opened_connections", "", c.tcpConnections, metricChannel, prometheus.GaugeValue)
 	// kamailio_tcp_writequeue
-	convertStatToMetric(completeStatMap, "tcp.current_write_queue_size", "", c.tcpWritequeue, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "tcp.current_write_queue_size", "", c.tcpWritequeue, metricChannel, prometheus.GaugeValue)
 
 	// kamailio_tmx_code_total
-	convertStatToMetric(completeStatMap, "tmx.2xx_transactions", "2xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tmx.3xx_transactions", "3xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tmx.4xx_transactions", "4xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tmx.5xx_transactions", "5xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tmx.6xx_transactions", "6xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.2xx_transactions", "2xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.3xx_transactions", "3xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.4xx_transactions", "4xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.5xx_transactions", "5xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.6xx_transactions", "6xx", c.tmxCodeTotal, metricChannel, prometheus.CounterValue)
 	// kamailio_tmx_type_total
-	convertStatToMetric(completeStatMap, "tmx.UAC_transactions", "uac", c.tmxTypeTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tmx.UAS_transactions", "uas", c.tmxTypeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.UAC_transactions", "uac", c.tmxTypeTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.UAS_transactions", "uas", c.tmxTypeTotal, metricChannel, prometheus.CounterValue)
 	// kamailio_tmx
-	convertStatToMetric(completeStatMap, "tmx.active_transactions", "active", c.tmx, metricChannel, prometheus.GaugeValue)
-	convertStatToMetric(completeStatMap, "tmx.inuse_transactions", "inuse", c.tmx, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "tmx.active_transactions", "active", c.tmx, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "tmx.inuse_transactions", "inuse", c.tmx, metricChannel, prometheus.GaugeValue)
 
 	// kamailio_tmx_rpl_total
-	convertStatToMetric(completeStatMap, "tmx.rpl_absorbed", "absorbed", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tmx.rpl_generated", "generated", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tmx.rpl_received", "received", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tmx.rpl_relayed", "relayed", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "tmx.rpl_sent", "sent", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.rpl_absorbed", "absorbed", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.rpl_generated", "generated", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.rpl_received", "received", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.rpl_relayed", "relayed", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tmx.rpl_sent", "sent", c.tmxRplTotal, metricChannel, prometheus.CounterValue)
 
 	// kamailio_dialog
-	convertStatToMetric(completeStatMap, "dialog.active_dialogs", "active_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "dialog.early_dialogs", "early_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "dialog.expired_dialogs", "expired_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "dialog.failed_dialogs", "failed_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
-	convertStatToMetric(completeStatMap, "dialog.processed_dialogs", "processed_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "dialog.active_dialogs", "active_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "dialog.early_dialogs", "early_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "dialog.expired_dialogs", "expired_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "dialog.failed_dialogs", "failed_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "dialog.processed_dialogs", "processed_dialogs", c.dialog, metricChannel, prometheus.CounterValue)
+
+	// kamailio_dialog_terminated_total, the dialog module doesn't count the BYEs
+	c.convertStatToMetric(completeStatMap, "dialog.expired_dialogs", "timeout", c.dialogTerminated, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "dialog.failed_dialogs", "failed", c.dialogTerminated, metricChannel, prometheus.CounterValue)
+
+	// kamailio_tsilo_total
+	c.convertStatToMetric(completeStatMap, "tsilo.total_ruris", "ruris", c.tsiloTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tsilo.total_transactions", "transactions", c.tsiloTotal, metricChannel, prometheus.CounterValue)
+	c.convertStatToMetric(completeStatMap, "tsilo.added_branches", "added_branches", c.tsiloTotal, metricChannel, prometheus.CounterValue)
+	// kamailio_tsilo_stored
+	c.convertStatToMetric(completeStatMap, "tsilo.stored_ruris", "ruris", c.tsiloStored, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "tsilo.stored_transactions", "transactions", c.tsiloStored, metricChannel, prometheus.GaugeValue)
+
+	// kamailio_usrloc_registered_users
+	c.convertStatToMetric(completeStatMap, "usrloc.registered_users", "", c.usrlocUsers, metricChannel, prometheus.GaugeValue)
+	c.convertStatToMetric(completeStatMap, "p_usrloc.registered_users", "", c.usrlocUsers, metricChannel, prometheus.GaugeValue)
+	// kamailio_usrloc_contacts
+	convertUsrlocContacts(completeStatMap, c, metricChannel)
+}
+
+// Usrloc registers a "<table>-contacts" and a "<table>-expires" stat for each location table in use.
+// These counters only reflect the contacts known to this instance.
+func convertUsrlocContacts(completeStatMap map[string]string, c *StatsFetchCollector, metricChannel chan<- prometheus.Metric) {
+	for k := range completeStatMap {
+		// k = "usrloc.location-contacts"
+		for _, group := range []string{"usrloc.", "p_usrloc."} {
+			if !strings.HasPrefix(k, group) {
+				continue
+			}
+			if strings.HasSuffix(k, "-contacts") {
+				table := strings.TrimSuffix(strings.TrimPrefix(k, group), "-contacts")
+				c.convertStatToLabeledMetric(completeStatMap, k, c.usrlocContacts, metricChannel, prometheus.GaugeValue, table, "local")
+			}
+			// k = "usrloc.location-expires"
+			if strings.HasSuffix(k, "-expires") {
+				table := strings.TrimSuffix(strings.TrimPrefix(k, group), "-expires")
+				c.convertStatToLabeledMetric(completeStatMap, k, c.usrlocExpired, metricChannel, prometheus.CounterValue, table)
+			}
+		}
+	}
+}
+
+// Only the configured codes are exported, to bound the cardinality.
+// Their statistics are removed from the map so they aren't exported twice as scripted metrics.
+func (c *StatsFetchCollector) convertResponseCodes(completeStatMap map[string]string, metricChannel chan<- prometheus.Metric) {
+	for _, code := range c.responseCodes {
+		// k = "script.sip_responses_503"
+		k := responseCodeStatPrefix + code
+		c.convertStatToMetric(completeStatMap, k, code, c.sipResponsesTotal, metricChannel, prometheus.CounterValue)
+		delete(completeStatMap, k)
+	}
 }
 
 // Iterate all reported "stats" keys and find those with a prefix of "script."
 // These values are user-defined and populated within the kamailio script.
 // See https://www.kamailio.org/docs/modules/5.2.x/modules/statistics.html
-func convertScriptedMetrics(data map[string]string, prom chan<- prometheus.Metric) {
+func (c *StatsFetchCollector) convertScriptedMetrics(data map[string]string, prom chan<- prometheus.Metric) {
 	for k := range data {
 		// k = "script.custom_total"
 		if strings.HasPrefix(k, "script.") {
@@ -328,16 +592,27 @@ func convertScriptedMetrics(data map[string]string, prom chan<- prometheus.Metri
 				valueType = prometheus.GaugeValue
 			}
 			// create a metric description on the fly
-			description := prometheus.NewDesc("kamailio_"+metricName, "Scripted metric "+metricName, []string{}, nil)
+			description := prometheus.NewDesc(prometheus.BuildFQName(c.namespace, "", metricName), "Scripted metric "+metricName, []string{}, nil)
 			// and produce a metric
-			convertStatToMetric(data, k, "", description, prom, valueType)
+			c.convertStatToMetric(data, k, "", description, prom, valueType)
 		}
 	}
 }
 
+// round a value to the configured number of decimals
+// integer values are left untouched
+func roundFloat(value float64, precision int) float64 {
+	// value*p loses the low digits of the integers above 2^53
+	if precision < 0 || value == math.Trunc(value) {
+		return value
+	}
+	p := math.Pow10(precision)
+	return math.Round(value*p) / p
+}
+
 // convert a single "stat" value to a prometheus metric
 // invalid "stat" paires are skipped but logged
-func convertStatToMetric(completeStatMap map[string]string, statKey string, optionalLabelValue string, metricDescription *prometheus.Desc, metricChannel chan<- prometheus.Metric, valueType prometheus.ValueType) {
+func (c *StatsFetchCollector) convertStatToMetric(completeStatMap map[string]string, statKey string, optionalLabelValue string, metricDescription *prometheus.Desc, metricChannel chan<- prometheus.Metric, valueType prometheus.ValueType) {
 	// check wether we got a labelValue or not
 	var labelValues []string
 	if optionalLabelValue != "" {
@@ -345,10 +620,20 @@ func convertStatToMetric(completeStatMap map[string]string, statKey string, opti
 	} else {
 		labelValues = []string{}
 	}
+	c.convertStatToLabeledMetric(completeStatMap, statKey, metricDescription, metricChannel, valueType, labelValues...)
+}
+
+// convert a single "stat" value to a prometheus metric with several labels
+func (c *StatsFetchCollector) convertStatToLabeledMetric(completeStatMap map[string]string, statKey string, metricDescription *prometheus.Desc, metricChannel chan<- prometheus.Metric, valueType prometheus.ValueType, labelValues ...string) {
 	// get the stat-value ...
 	if valueAsString, ok := completeStatMap[statKey]; ok {
 		// ... convert it to a float
 		if value, err := strconv.ParseFloat(valueAsString, 64); err == nil {
+			// a counter can't go below zero, skip it rather than break rate()
+			if valueType == prometheus.CounterValue && value < 0 {
+				return
+			}
+			value = roundFloat(value, c.floatPrecision)
 			// and produce a prometheus metric
 			metric, err := prometheus.NewConstMetric(
 				metricDescription,
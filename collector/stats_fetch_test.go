@@ -0,0 +1,247 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestConvertStatToLabeledMetric(t *testing.T) {
+	desc := prometheus.NewDesc("kamailio_test", "Test statistic", []string{"group"}, nil)
+	tests := []struct {
+		value     string
+		valueType prometheus.ValueType
+		precision int
+		exported  bool
+		want      float64
+	}{
+		{"42", prometheus.CounterValue, -1, true, 42},
+		{"0.125", prometheus.GaugeValue, -1, true, 0.125},
+		{"-3.5", prometheus.GaugeValue, -1, true, -3.5},
+		{"-12", prometheus.GaugeValue, -1, true, -12},
+		{"1e3", prometheus.GaugeValue, -1, true, 1000},
+		{"0.1234", prometheus.GaugeValue, 2, true, 0.12},
+		// above 2^53, rounding multiplied values would change the integer
+		{"123456789012345678", prometheus.CounterValue, 2, true, 123456789012345678},
+		{"-1", prometheus.CounterValue, -1, false, 0},
+		{"-0.5", prometheus.CounterValue, -1, false, 0},
+		{"12abc", prometheus.GaugeValue, -1, false, 0},
+		{"", prometheus.GaugeValue, -1, false, 0},
+	}
+	for _, test := range tests {
+		c := &StatsFetchCollector{floatPrecision: test.precision}
+		ch := make(chan prometheus.Metric, 1)
+		c.convertStatToLabeledMetric(map[string]string{"core.test": test.value}, "core.test", desc, ch, test.valueType, "core")
+		close(ch)
+		m, exported := <-ch
+		if exported != test.exported {
+			t.Errorf("%q as %v: exported %t, want %t", test.value, test.valueType, exported, test.exported)
+			continue
+		}
+		if !exported {
+			continue
+		}
+		metric := &dto.Metric{}
+		if err := m.Write(metric); err != nil {
+			t.Fatalf("%q: %v", test.value, err)
+		}
+		got := metric.GetGauge().GetValue()
+		if test.valueType == prometheus.CounterValue {
+			got = metric.GetCounter().GetValue()
+		}
+		if got != test.want {
+			t.Errorf("%q as %v: got %v, want %v", test.value, test.valueType, got, test.want)
+		}
+	}
+}
+
+func TestConvertStatToLabeledMetricMissing(t *testing.T) {
+	desc := prometheus.NewDesc("kamailio_test", "Test statistic", nil, nil)
+	c := &StatsFetchCollector{floatPrecision: -1}
+	ch := make(chan prometheus.Metric, 1)
+	c.convertStatToLabeledMetric(map[string]string{}, "core.test", desc, ch, prometheus.GaugeValue)
+	if len(ch) != 0 {
+		t.Errorf("a missing statistic was exported")
+	}
+}
+
+// fakeStatsFetch answers stats.fetch with the statistics of the requested
+// groups, "all" or "GROUP:", like Kamailio.
+func fakeStatsFetch(mtx *sync.Mutex, stats map[string]string) func(args []string) fakeReply {
+	return func(args []string) fakeReply {
+		mtx.Lock()
+		defer mtx.Unlock()
+		members := make(map[string][]byte)
+		for _, arg := range args[1:] {
+			for name, value := range stats {
+				if arg == "all" || strings.HasPrefix(name, strings.TrimSuffix(arg, ":")+".") {
+					members[name] = binrpcString(value)
+				}
+			}
+		}
+		return binrpcReply(binrpcStruct(members))
+	}
+}
+
+func TestStatsFetchDiscoversNewStatistics(t *testing.T) {
+	tests := []struct {
+		name   string
+		groups []string
+	}{
+		{"all", nil},
+		// the scripted statistics are fetched with the groups too
+		{"groups", []string{"core"}},
+	}
+	for _, test := range tests {
+		var mtx sync.Mutex
+		stats := map[string]string{"core.rcv_requests": "10", "script.old_total": "1"}
+		k := newFakeKamailio(fakeStatsFetch(&mtx, stats))
+		config := &KamailioCollectorConfig{}
+		if test.groups != nil {
+			config.StatsFetch.Groups = &test.groups
+		}
+		c, err := NewStatsFetchCollector(config, log.NewNopLogger())
+		if err != nil {
+			t.Fatalf("NewStatsFetchCollector: %v", err)
+		}
+
+		for scrape, wantNew := range []bool{false, true} {
+			families, err := gatherSubCollector(t, c, k)
+			if err != nil {
+				t.Fatalf("%s, scrape %d: %v", test.name, scrape, err)
+			}
+			if families["kamailio_old_total"] == nil {
+				t.Errorf("%s, scrape %d: kamailio_old_total is missing", test.name, scrape)
+			}
+			if family := families["kamailio_new_total"]; (family != nil) != wantNew {
+				t.Errorf("%s, scrape %d: got kamailio_new_total %v, want it %t", test.name, scrape, family, wantNew)
+			} else if wantNew && family.Metric[0].GetCounter().GetValue() != 5 {
+				t.Errorf("%s, scrape %d: got kamailio_new_total %v, want 5", test.name, scrape, family)
+			}
+			// registered by the script after the previous scrape
+			mtx.Lock()
+			stats["script.new_total"] = "5"
+			mtx.Unlock()
+		}
+	}
+}
+
+func TestScrapeDiscoversReloadedStatistics(t *testing.T) {
+	var mtx sync.Mutex
+	stats := map[string]string{"script.calls_total": "3"}
+	fetch := fakeStatsFetch(&mtx, stats)
+	k := newFakeKamailio(func(args []string) fakeReply {
+		if args[0] == "system.listMethods" {
+			return binrpcReply(binrpcString("system.listMethods"), binrpcString("stats.fetch"))
+		}
+		return fetch(args)
+	})
+	uri := k.listen(t)
+	c, err := NewKamailioCollector(&KamailioCollectorConfig{BinrpcURI: &uri}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewKamailioCollector: %v", err)
+	}
+	defer c.Close()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	for scrape, wantReloaded := range []bool{false, false, true, true} {
+		if scrape == 2 {
+			// the reloaded script registers a new counter, Kamailio keeps running
+			mtx.Lock()
+			stats["script.reloaded_total"] = "1"
+			mtx.Unlock()
+		}
+		families, err := registry.Gather()
+		if err != nil {
+			t.Fatalf("scrape %d: %v", scrape, err)
+		}
+		names := make(map[string]bool)
+		for _, family := range families {
+			names[family.GetName()] = true
+		}
+		if !names["kamailio_calls_total"] || names["kamailio_reloaded_total"] != wantReloaded {
+			t.Errorf("scrape %d: got %v, want kamailio_reloaded_total %t", scrape, names, wantReloaded)
+		}
+	}
+}
+
+func TestWarnEmptyGroupsOnce(t *testing.T) {
+	var mtx sync.Mutex
+	stats := map[string]string{"core.rcv_requests": "10"}
+	k := newFakeKamailio(fakeStatsFetch(&mtx, stats))
+	var buf bytes.Buffer
+	groups := []string{"core", "tmx"}
+	config := &KamailioCollectorConfig{}
+	config.StatsFetch.Groups = &groups
+	c, err := NewStatsFetchCollector(config, log.NewLogfmtLogger(log.NewSyncWriter(&buf)))
+	if err != nil {
+		t.Fatalf("NewStatsFetchCollector: %v", err)
+	}
+
+	scrape := func() (warnings int, debugs int) {
+		t.Helper()
+		buf.Reset()
+		if _, err := gatherSubCollector(t, c, k); err != nil {
+			t.Fatalf("scrape: %v", err)
+		}
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if !strings.Contains(line, "group=tmx") {
+				continue
+			}
+			if strings.Contains(line, "level=warn") {
+				warnings++
+			} else if strings.Contains(line, "level=debug") {
+				debugs++
+			}
+		}
+		return warnings, debugs
+	}
+
+	// warned once, then logged at debug level
+	for i, want := range []int{1, 0, 0} {
+		warnings, debugs := scrape()
+		if warnings != want || debugs != 1-want {
+			t.Errorf("scrape %d: got %d warnings and %d debug messages, want %d and %d", i, warnings, debugs, want, 1-want)
+		}
+	}
+	// warned again once the group came back and went away
+	mtx.Lock()
+	stats["tmx.UAS_transactions"] = "1"
+	mtx.Unlock()
+	if warnings, debugs := scrape(); warnings != 0 || debugs != 0 {
+		t.Errorf("group present: got %d warnings and %d debug messages, want none", warnings, debugs)
+	}
+	mtx.Lock()
+	delete(stats, "tmx.UAS_transactions")
+	mtx.Unlock()
+	if warnings, _ := scrape(); warnings != 1 {
+		t.Errorf("group gone again: got %d warnings, want 1", warnings)
+	}
+}
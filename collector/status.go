@@ -0,0 +1,94 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	statusOK          = "ok"
+	statusUnsupported = "unsupported"
+	statusError       = "error"
+	statusSkipped     = "skipped"
+)
+
+// CollectorStatus is the outcome of the last run of a collector.
+type CollectorStatus struct {
+	Status    string  `json:"status"`
+	Duration  float64 `json:"duration_seconds"`
+	LastError string  `json:"last_error,omitempty"`
+}
+
+// HealthStatus summarizes the last scrape of Kamailio.
+type HealthStatus struct {
+	Up         bool                       `json:"up"`
+	Starting   bool                       `json:"starting,omitempty"`
+	LastScrape time.Time                  `json:"last_scrape"`
+	Collectors map[string]CollectorStatus `json:"collectors"`
+}
+
+var (
+	healthStatusMtx = sync.Mutex{}
+	healthStatus    = HealthStatus{Collectors: make(map[string]CollectorStatus)}
+)
+
+// Health returns a copy of the status recorded during the last scrape.
+func Health() HealthStatus {
+	healthStatusMtx.Lock()
+	defer healthStatusMtx.Unlock()
+	collectors := make(map[string]CollectorStatus, len(healthStatus.Collectors))
+	for name, status := range healthStatus.Collectors {
+		collectors[name] = status
+	}
+	return HealthStatus{Up: healthStatus.Up, LastScrape: healthStatus.LastScrape, Collectors: collectors}
+}
+
+// Warnings lists the collectors which didn't run successfully, as sorted "name=status" pairs.
+func (h HealthStatus) Warnings() []string {
+	warnings := make([]string, 0)
+	if !h.Up {
+		return append(warnings, "kamailio=down")
+	}
+	for name, status := range h.Collectors {
+		if status.Status != statusOK {
+			warnings = append(warnings, name+"="+status.Status)
+		}
+	}
+	sort.Strings(warnings)
+	return warnings
+}
+
+func setUpStatus(up bool) {
+	healthStatusMtx.Lock()
+	defer healthStatusMtx.Unlock()
+	healthStatus.Up = up
+	healthStatus.LastScrape = time.Now()
+}
+
+func setCollectorStatus(name string, status CollectorStatus) {
+	healthStatusMtx.Lock()
+	defer healthStatusMtx.Unlock()
+	healthStatus.Collectors[name] = status
+}
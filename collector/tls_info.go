@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 
 	"github.com/go-kit/log"
@@ -41,7 +42,7 @@ type TLSInfoCollector struct {
 }
 
 // NewTLSInfoCollector returns a new Collector exposing TLS metrics.
-func NewTLSInfoCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewTLSInfoCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	return &TLSInfoCollector{
 		openedConnections: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "tls", "opened_connections"),
@@ -49,18 +50,24 @@ func NewTLSInfoCollector(config *KamailioCollectorConfig, logger log.Logger) (Co
 			[]string{}, nil),
 		maxConnections: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "tls", "max_connections"),
-			"TLS Opened Connections",
+			"TLS connection limit",
 			[]string{}, nil),
 		clearTextWrite: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, "tls", "clear_text_write_queued_bytes"),
-			"TLS Opened Connections",
+			"TLS clear text bytes queued for writing",
 			[]string{}, nil),
 		logger: logger,
 		config: config,
 	}, nil
 }
 
-func (c *TLSInfoCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *TLSInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.openedConnections
+	ch <- c.maxConnections
+	ch <- c.clearTextWrite
+}
+
+func (c *TLSInfoCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "tls.info")
 	if err != nil {
 		return err
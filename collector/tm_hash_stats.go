@@ -0,0 +1,112 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func init() {
+	// the command fails unless tm is compiled with TM_HASH_STATS
+	registerConfiguredCollector("tm.hash_stats", func(config *KamailioCollectorConfig) bool {
+		return config.Tm.HashStats != nil && *config.Tm.HashStats
+	}, NewTmHashStatsCollector)
+}
+
+type tmHashStatsCollector struct {
+	size         *prometheus.Desc
+	entries      *prometheus.Desc
+	bucket       *prometheus.Desc
+	emptyBuckets *prometheus.Desc
+	logger       log.Logger
+	config       *KamailioCollectorConfig
+}
+
+// NewTmHashStatsCollector returns a new Collector exposing the transaction hash table usage.
+func NewTmHashStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &tmHashStatsCollector{
+		size: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tm_hash", "size"),
+			"Number of buckets of the transaction hash table",
+			[]string{}, nil),
+		entries: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tm_hash", "entries"),
+			"Transactions in the hash table",
+			[]string{}, nil),
+		bucket: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tm_hash", "bucket_entries"),
+			"Distribution of the transactions in the hash table buckets",
+			[]string{"stat"}, nil),
+		emptyBuckets: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "tm_hash", "empty_buckets"),
+			"Number of buckets without transaction",
+			[]string{}, nil),
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (c *tmHashStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.size
+	ch <- c.entries
+	ch <- c.bucket
+	ch <- c.emptyBuckets
+}
+
+func (c *tmHashStatsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, "tm.hash_stats")
+	if err != nil {
+		return err
+	}
+
+	// only the current values are exported, the "acc_" ones accumulate since startup
+	for _, record := range records {
+		items, _ := record.StructItems()
+		for _, item := range items {
+			value, ok := recordNumber(item.Value)
+			if !ok {
+				continue
+			}
+			switch item.Key {
+			case "hash_size":
+				metricChannel <- prometheus.MustNewConstMetric(c.size, prometheus.GaugeValue, value)
+			case "crt_transactions":
+				metricChannel <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, value)
+			case "crt_target_per_cell":
+				metricChannel <- prometheus.MustNewConstMetric(c.bucket, prometheus.GaugeValue, value, "average")
+			case "crt_min":
+				metricChannel <- prometheus.MustNewConstMetric(c.bucket, prometheus.GaugeValue, value, "min")
+			case "crt_max":
+				metricChannel <- prometheus.MustNewConstMetric(c.bucket, prometheus.GaugeValue, value, "max")
+			case "crt_std_dev":
+				metricChannel <- prometheus.MustNewConstMetric(c.bucket, prometheus.GaugeValue, value, "std_dev")
+			case "crt_zero_cells":
+				metricChannel <- prometheus.MustNewConstMetric(c.emptyBuckets, prometheus.GaugeValue, value)
+			}
+		}
+	}
+	return nil
+}
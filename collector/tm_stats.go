@@ -22,6 +22,7 @@
 package collector
 
 import (
+	"context"
 	"net"
 	"regexp"
 
@@ -47,7 +48,7 @@ type tmStatsCollector struct {
 }
 
 // NewCoreStatsCollector returns a new Collector exposing core stats.
-func NewTmStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (Collector, error) {
+func NewTmStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
 	gauges := map[string]*prometheus.Desc{
 		"current": prometheus.NewDesc(prometheus.BuildFQName(namespace, "tm_stats", "current"), "Current transactions.", []string{}, nil),
 		"waiting": prometheus.NewDesc(prometheus.BuildFQName(namespace, "tm_stats", "waiting"), "Waiting transactions.", []string{}, nil),
@@ -73,7 +74,17 @@ func NewTmStatsCollector(config *KamailioCollectorConfig, logger log.Logger) (Co
 	}, nil
 }
 
-func (c *tmStatsCollector) Update(conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+func (c *tmStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.codes
+	for _, desc := range c.counters {
+		ch <- desc
+	}
+	for _, desc := range c.gauges {
+		ch <- desc
+	}
+}
+
+func (c *tmStatsCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
 	records, err := getRecords(conn, c.logger, "tm.stats")
 	if err != nil {
 		return err
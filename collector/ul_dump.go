@@ -0,0 +1,152 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.angarium.io/kamailio/binrpc"
+)
+
+func init() {
+	// dumping usrloc is expensive, only do it when asked to
+	registerConfiguredCollector("ul.dump", func(config *KamailioCollectorConfig) bool {
+		return config.Usrloc.RealmTopN != nil && *config.Usrloc.RealmTopN > 0
+	}, NewUlDumpCollector)
+}
+
+// realm reported for the contacts beyond the top N realms, which can't be a
+// domain so it doesn't merge with a realm named "other"
+const otherRealm = "__other__"
+
+type ulDumpCollector struct {
+	contacts *prometheus.Desc
+	logger   log.Logger
+	config   *KamailioCollectorConfig
+}
+
+// NewUlDumpCollector returns a new Collector exposing registered contacts per realm.
+func NewUlDumpCollector(config *KamailioCollectorConfig, logger log.Logger) (SubCollector, error) {
+	return &ulDumpCollector{
+		contacts: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "registered_contacts"),
+			"Number of registered contacts per realm",
+			[]string{"realm"}, nil),
+		config: config,
+		logger: logger,
+	}, nil
+}
+
+func (c *ulDumpCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.contacts
+}
+
+func (c *ulDumpCollector) Collect(ctx context.Context, conn net.Conn, metricChannel chan<- prometheus.Metric) error {
+	records, err := getRecords(conn, c.logger, "ul.dump")
+	if err != nil {
+		return err
+	}
+
+	realms := make(map[string]int)
+	for _, record := range records {
+		items, _ := record.StructItems()
+		for _, item := range items {
+			if item.Key != "Domains" {
+				continue
+			}
+			domains, _ := item.Value.StructItems()
+			for _, domain := range domains {
+				countDomainContacts(domain, realms)
+			}
+		}
+	}
+
+	for realm, count := range topRealms(realms, *c.config.Usrloc.RealmTopN) {
+		metricChannel <- prometheus.MustNewConstMetric(c.contacts, prometheus.GaugeValue, float64(count), realm)
+	}
+	return nil
+}
+
+// countDomainContacts adds the contacts of each AoR of a usrloc domain to its
+// realm. The AoRs without a domain part, as with use_domain=0, are skipped.
+func countDomainContacts(domain binrpc.StructItem, realms map[string]int) {
+	props, _ := domain.Value.StructItems()
+	for _, prop := range props {
+		if prop.Key != "AoRs" {
+			continue
+		}
+		aors, _ := prop.Value.StructItems()
+		for _, aor := range aors {
+			info, _ := aor.Value.StructItems()
+			realm := ""
+			hasRealm := false
+			var contacts int
+			for _, attr := range info {
+				switch attr.Key {
+				case "AoR":
+					name, _ := attr.Value.String()
+					if i := strings.LastIndex(name, "@"); i >= 0 {
+						realm = strings.ToLower(name[i+1:])
+						hasRealm = true
+					}
+				case "Contacts":
+					list, _ := attr.Value.StructItems()
+					contacts = len(list)
+				}
+			}
+			if hasRealm {
+				realms[realm] += contacts
+			}
+		}
+	}
+}
+
+// topRealms keeps the n realms with the most contacts and sums up the others.
+func topRealms(realms map[string]int, n int) map[string]int {
+	if len(realms) <= n {
+		return realms
+	}
+	names := make([]string, 0, len(realms))
+	for realm := range realms {
+		names = append(names, realm)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if realms[names[i]] == realms[names[j]] {
+			return names[i] < names[j]
+		}
+		return realms[names[i]] > realms[names[j]]
+	})
+	result := make(map[string]int, n+1)
+	for i, realm := range names {
+		if i < n {
+			result[realm] = realms[realm]
+		} else {
+			result[otherRealm] += realms[realm]
+		}
+	}
+	return result
+}
@@ -0,0 +1,89 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package collector
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestTopRealms(t *testing.T) {
+	realms := map[string]int{"example.org": 5, "other": 3, "b.net": 2, "a.net": 1}
+	tests := []struct {
+		n    int
+		want map[string]int
+	}{
+		{4, realms},
+		// a realm named other isn't merged with the ones beyond the top
+		{2, map[string]int{"example.org": 5, "other": 3, otherRealm: 3}},
+		{1, map[string]int{"example.org": 5, otherRealm: 6}},
+	}
+	for _, test := range tests {
+		if got := topRealms(realms, test.n); !maps.Equal(got, test.want) {
+			t.Errorf("top %d: got %v, want %v", test.n, got, test.want)
+		}
+	}
+}
+
+func TestUlDumpRealms(t *testing.T) {
+	aor := func(name string, contacts int) []byte {
+		list := make([][]byte, contacts)
+		for i := range list {
+			list[i] = binrpcStruct(map[string][]byte{"Expires": binrpcInt(3600)})
+		}
+		return binrpcStruct(map[string][]byte{
+			"AoR":      binrpcString(name),
+			"Contacts": binrpcList("Contact", list...),
+		})
+	}
+	k := newFakeKamailio(func(args []string) fakeReply {
+		aors := binrpcList("Info",
+			aor("alice@Example.org", 2),
+			aor("bob@example.org", 1),
+			aor("carol@other", 2),
+			aor("dave@b.net", 1),
+			// usrloc without use_domain
+			aor("eve", 4))
+		domain := binrpcStruct(map[string][]byte{"Domain": binrpcString("location"), "AoRs": aors})
+		return binrpcReply(binrpcStruct(map[string][]byte{"Domains": binrpcList("Domain", domain)}))
+	})
+	topN := 2
+	config := &KamailioCollectorConfig{}
+	config.Usrloc.RealmTopN = &topN
+	c, err := NewUlDumpCollector(config, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewUlDumpCollector: %v", err)
+	}
+	metrics, err := collectSubCollector(t, c, k)
+	if err != nil {
+		t.Fatalf("Collect: %v", err)
+	}
+	got := make(map[string]int)
+	for _, m := range metrics {
+		got[m.GetLabel()[0].GetValue()] = int(m.GetGauge().GetValue())
+	}
+	if want := map[string]int{"example.org": 3, "other": 2, otherRealm: 1}; !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
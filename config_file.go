@@ -0,0 +1,107 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	"gopkg.in/yaml.v2"
+)
+
+// configFileFlag returns the path given with --config.file, before the
+// command line is parsed, so the file can set the defaults of the flags.
+func configFileFlag(args []string) string {
+	for i, arg := range args {
+		if value, ok := strings.CutPrefix(arg, "--config.file="); ok {
+			return value
+		}
+		if arg == "--config.file" && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// loadConfigFile reads a YAML document whose keys are the flag names, and uses
+// its values as the defaults of these flags. The command line and the
+// environment variables still override them. E.g.:
+//
+//	kamailio.binrpc-uri: tcp://127.0.0.1:2049
+//	kamailio.timeout: 3s
+//	collector.stats.groups: [shmem, tm, sl]
+func loadConfigFile(app *kingpin.Application, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]interface{})
+	if err := yaml.UnmarshalStrict(content, &values); err != nil {
+		return fmt.Errorf("cannot parse %s: %w", path, err)
+	}
+	for name, value := range values {
+		flag := app.GetFlag(name)
+		if flag == nil || name == "config.file" {
+			return fmt.Errorf("unknown flag %q in %s", name, path)
+		}
+		// repeatable flags take a list
+		switch v := value.(type) {
+		case []interface{}:
+			if !isCumulative(flag) {
+				return fmt.Errorf("flag %q in %s takes a single value, not a list", name, path)
+			}
+			defaults := make([]string, 0, len(v))
+			for _, item := range v {
+				if !isScalar(item) {
+					return fmt.Errorf("flag %q in %s takes a list of values, not of %T", name, path, item)
+				}
+				defaults = append(defaults, fmt.Sprint(item))
+			}
+			flag.Default(defaults...)
+		case nil:
+			flag.Default("")
+		default:
+			if !isScalar(v) {
+				return fmt.Errorf("flag %q in %s takes a value, not a mapping", name, path)
+			}
+			flag.Default(fmt.Sprint(v))
+		}
+	}
+	return nil
+}
+
+// isCumulative tells whether a flag is repeatable, e.g. a list of strings.
+func isCumulative(flag *kingpin.FlagClause) bool {
+	v, ok := flag.Model().Value.(interface{ IsCumulative() bool })
+	return ok && v.IsCumulative()
+}
+
+// isScalar tells whether a YAML value is a string, a number or a boolean.
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case []interface{}, map[interface{}]interface{}, nil:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	tests := []struct {
+		content string
+		err     string
+		uri     string
+		groups  []string
+	}{
+		{"kamailio.binrpc-uri: tcp://127.0.0.1:2049\n", "", "tcp://127.0.0.1:2049", nil},
+		{"collector.stats.groups: [shmem, tm]\n", "", "", []string{"shmem", "tm"}},
+		{"collector.stats.groups: shmem\n", "", "", []string{"shmem"}},
+		{"kamailio.binrpc-uri: [tcp://127.0.0.1:2049, tcp://127.0.0.1:2050]\n", "single value", "", nil},
+		{"kamailio.binrpc-uri: {host: 127.0.0.1}\n", "mapping", "", nil},
+		{"collector.stats.groups: [{name: shmem}]\n", "list of values", "", nil},
+		{"collector.stats.groups: [[shmem]]\n", "list of values", "", nil},
+		{"kamailio.unknown: 1\n", "unknown flag", "", nil},
+	}
+	for _, test := range tests {
+		app := kingpin.New("test", "")
+		uri := app.Flag("kamailio.binrpc-uri", "").Default("").String()
+		groups := app.Flag("collector.stats.groups", "").Strings()
+		path := filepath.Join(t.TempDir(), "config.yml")
+		if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		err := loadConfigFile(app, path)
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("%q: error = %v, want %q", test.content, err, test.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", test.content, err)
+			continue
+		}
+		if _, err := app.Parse(nil); err != nil {
+			t.Errorf("%q: parsing: %v", test.content, err)
+			continue
+		}
+		if *uri != test.uri || (test.groups != nil && !slices.Equal(*groups, test.groups)) {
+			t.Errorf("%q: got %q and %q, want %q and %q", test.content, *uri, *groups, test.uri, test.groups)
+		}
+	}
+}
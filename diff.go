@@ -0,0 +1,141 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// seriesSignatures scrapes c once, and returns the sorted metric names with
+// their label names, e.g. "kamailio_sl_stats_codes_total{code}". The values,
+// and the label values, are left out.
+func seriesSignatures(c prometheus.Collector) ([]string, error) {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(c); err != nil {
+		return nil, err
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make([]string, 0, len(metric.GetLabel()))
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, label.GetName())
+			}
+			sort.Strings(labels)
+			seen[family.GetName()+"{"+strings.Join(labels, ",")+"}"] = true
+		}
+	}
+	signatures := make([]string, 0, len(seen))
+	for signature := range seen {
+		signatures = append(signatures, signature)
+	}
+	sort.Strings(signatures)
+	return signatures, nil
+}
+
+// readSignatures reads a snapshot written by writeSignatures, one signature by
+// line. The empty lines and the lines starting with "#" are ignored.
+func readSignatures(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	signatures := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		signatures[line] = true
+	}
+	return signatures, scanner.Err()
+}
+
+func writeSignatures(path string, signatures []string) error {
+	return os.WriteFile(path, []byte(strings.Join(signatures, "\n")+"\n"), 0o644)
+}
+
+// diffSignatures prints the series added ("+") and removed ("-") since the
+// snapshot, and returns whether the set changed.
+func diffSignatures(w io.Writer, snapshot map[string]bool, signatures []string) bool {
+	current := make(map[string]bool, len(signatures))
+	changed := false
+	for _, signature := range signatures {
+		current[signature] = true
+		if !snapshot[signature] {
+			fmt.Fprintln(w, "+ "+signature)
+			changed = true
+		}
+	}
+	removed := make([]string, 0)
+	for signature := range snapshot {
+		if !current[signature] {
+			removed = append(removed, signature)
+		}
+	}
+	sort.Strings(removed)
+	for _, signature := range removed {
+		fmt.Fprintln(w, "- "+signature)
+		changed = true
+	}
+	return changed
+}
+
+// runDiff scrapes c once and compares the series with the snapshot file, or
+// rewrites the file when update is set. It returns the exit code: 0 when the
+// series didn't change, 1 when they did and 2 on errors.
+func runDiff(c prometheus.Collector, path string, update bool) int {
+	signatures, err := seriesSignatures(c)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if update {
+		if err := writeSignatures(path, signatures); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		return 0
+	}
+	snapshot, err := readSignatures(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if diffSignatures(os.Stdout, snapshot, signatures) {
+		return 1
+	}
+	return 0
+}
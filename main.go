@@ -23,10 +23,20 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/alecthomas/kingpin/v2"
 	"github.com/angarium-cloud/kamailio_exporter/collector"
@@ -44,6 +54,10 @@ import (
 )
 
 func init() {
+	// builds outside of promu can still set the version with -X main.Version=...
+	if Version != "" && version.Version == "" {
+		version.Version = Version
+	}
 	prometheus.MustRegister(version.NewCollector("kamailio_exporter"))
 }
 
@@ -53,7 +67,34 @@ func AddFlags(a *kingpin.Application) *collector.KamailioCollectorConfig {
 	config := &collector.KamailioCollectorConfig{}
 	config.BinrpcURI = a.Flag("kamailio.binrpc-uri", `BINRPC URI on which to scrape kamailio. E.g. "tcp://localhost:3012"`).Default("unix:///var/run/kamailio/kamailio_ctl").String()
 	config.Timeout = a.Flag("kamailio.timeout", "Timeout for trying to get stats from Kamailio using BINRPC.").Short('t').Default("5s").Duration()
+	config.Reconnect = a.Flag("kamailio.reconnect", "Open a new BINRPC connection for each scrape, instead of keeping it open.").Default("false").Bool()
+	config.MaxRetries = a.Flag("kamailio.max-retries", "Retries of a BINRPC command on a new connection, after a connection error. The delay starts at 100ms and doubles, within the timeout.").Default("2").Int()
+	config.RetryFaultCodes = a.Flag("kamailio.retry-fault-codes", `Fault codes of the BINRPC commands which are retried, until the timeout. Comma separated or repeatable. Defaults to "503".`).Default("").Strings()
+	config.ErrorLogInterval = a.Flag("kamailio.error-log-interval", "Minimum interval between two identical connection errors in the logs. 0 logs every error.").Default("1m").Duration()
+	config.MinScrapeInterval = a.Flag("kamailio.min-scrape-interval", "Answer the scrapes arriving faster than this interval with the previous result, without querying Kamailio. 0 disables it.").Default("0s").Duration()
+	config.Namespace = a.Flag("kamailio.metric-namespace", "Prefix of the metric names, instead of kamailio. The custom metrics are not renamed.").Default("kamailio").String()
+	config.MetricTimestamps = a.Flag("kamailio.metric-timestamps", `Attach the collection time to the metrics: "auto" only to the results replayed within the minimum scrape interval, "always" or "never".`).Default(collector.TimestampsAuto).Enum(collector.TimestampsAuto, collector.TimestampsAlways, collector.TimestampsNever)
+	config.TLS.Enabled = a.Flag("kamailio.tls", "Connect to the BINRPC TCP port of Kamailio with TLS.").Default("false").Bool()
+	config.TLS.CAFile = a.Flag("kamailio.tls-ca-file", "CA certificates verifying the certificate of Kamailio, instead of the system ones.").Default("").String()
+	config.TLS.CertFile = a.Flag("kamailio.tls-cert-file", "Client certificate sent to Kamailio.").Default("").String()
+	config.TLS.KeyFile = a.Flag("kamailio.tls-key-file", "Key of the client certificate.").Default("").String()
+	config.TLS.ServerName = a.Flag("kamailio.tls-server-name", "Server name sent to Kamailio and verified in its certificate, instead of the host of the BINRPC URI.").Default("").String()
+	config.TLS.InsecureSkipVerify = a.Flag("kamailio.tls-skip-verify", "Don't verify the certificate of Kamailio. Insecure, for testing only.").Default("false").Bool()
+	config.TrackCounterAnomalies = a.Flag("kamailio.track-counter-anomalies", "Count the counters decreasing between two scrapes while Kamailio didn't restart.").Default("false").Bool()
+	config.NormalizeURILabels = a.Flag("kamailio.normalize-uri-labels", `Lowercase the scheme and host of the SIP URIs in the labels, and remove their parameters. E.g. "sip:user@Host:5060;transport=udp" becomes "sip:user@host:5060".`).Default("false").Bool()
+	config.RPCLatencySummary = a.Flag("kamailio.rpc-latency-summary", "Observe the BINRPC command durations with a summary instead of a histogram.").Default("false").Bool()
+	config.RPCLatencyObjectives = a.Flag("kamailio.rpc-latency-objectives", `Summary objectives using the "QUANTILE:ERROR" format. Comma separated or repeatable.`).Default("0.5:0.05,0.9:0.01,0.99:0.001").Strings()
+	config.CollectorsEnabled = a.Flag("collectors.enabled", `Only run the collectors of these groups. A group is a collector, its module or "dialog", "tcp" or "stats". Comma separated or repeatable. E.g. "core,tm,sl"`).Default("").Strings()
+	config.CollectorsDisabled = a.Flag("collectors.disabled", `Don't run the collectors of these groups. Comma separated or repeatable. E.g. "dialog,dispatcher"`).Default("").Strings()
 	config.DialogProfile.Profiles = a.Flag("collector.dialog.profiles", "Select dialog profiles to query.").Default("").Strings()
+	config.ProcessFds.Enabled = a.Flag("collector.fds", "Read the file descriptors usage of the Kamailio processes from /proc. The exporter must run on the same host as Kamailio.").Default("false").Bool()
+	config.Tm.HashStats = a.Flag("collector.tm.hash-stats", "Export the transaction hash table usage. Kamailio must be compiled with TM_HASH_STATS.").Default("false").Bool()
+	config.Cfg.Params = a.Flag("collector.cfg.params", `Configuration parameters to export using the "GROUP.NAME" format. Comma separated or repeatable. E.g. "tcp.max_connections"`).Default("").Strings()
+	config.StatsFetch.FloatPrecision = a.Flag("collector.stats.float-precision", "Number of decimals kept for the statistics values. -1 keeps full precision.").Default("-1").Int()
+	config.Usrloc.RealmTopN = a.Flag("collector.usrloc.realm-top-n", "Export the registered contacts of the N realms with the most contacts, using ul.dump. 0 disables it.").Default("0").Int()
+	config.StatsFetch.ResponseCodes = a.Flag("collector.stats.response-codes", `Export the "sip_responses_CODE" scripted statistics of these SIP response codes as kamailio_sip_responses_total. Comma separated or repeatable. E.g. "408,503"`).Default("").Strings()
+	config.StatsFetch.MappingFile = a.Flag("collector.stats.mapping-file", "YAML file of rules mapping the statistics matching a regex to a labeled metric.").Default("").String()
+	config.StatsFetch.Groups = a.Flag("collector.stats.groups", `Only fetch these statistics groups instead of "all". Comma separated or repeatable. E.g. "shmem,tm,sl"`).Default("").Strings()
 	return config
 }
 
@@ -67,21 +108,76 @@ func main() {
 			"web.rtp-telemetry-path",
 			"Path under which to expose rtpengine metrics.",
 		).Default("").String()
+		rtpengineMetricsURL = kingpin.Flag(
+			"rtpengine.metrics-url",
+			`URL of the rtpengine metrics, exposed under --web.rtp-telemetry-path. Use "http+unix://%2Fpath%2Fto.sock/metrics" for a unix socket.`,
+		).Default("http://127.0.0.1:9901/metrics").Envar("RTPENGINE_METRICS_URL").String()
+		rtpengineTimeout = kingpin.Flag(
+			"rtpengine.timeout",
+			"Timeout for requesting the rtpengine metrics.",
+		).Default("5s").Duration()
+		probePath = kingpin.Flag(
+			"web.probe-path",
+			"Path under which to expose the metrics of the Kamailio given by the target parameter.",
+		).Default("").String()
 		customMetricsURL = kingpin.Flag(
 			"kamailio.custom-metrics-url",
 			"URL to request user defined metrics from kamailio",
 		).Default("").String()
+		customMetricsAccept = kingpin.Flag(
+			"kamailio.custom-metrics-accept",
+			"Accept header sent when requesting user defined metrics from kamailio",
+		).Default("text/plain").String()
+		warningsHeader = kingpin.Flag(
+			"web.warnings-header",
+			"Summarize the collectors which failed in the X-Kamailio-Exporter-Warnings response header.",
+		).Default("false").Bool()
+		startupGracePeriod = kingpin.Flag(
+			"web.startup-grace-period",
+			"Time after the start during which /-/health and /ready answer 200 while Kamailio is unreachable.",
+		).Default("0s").Duration()
+		gracePeriod = kingpin.Flag(
+			"web.grace-period",
+			"Time to wait for the running scrapes when shutting down.",
+		).Default("5s").Duration()
 		toolkitFlags  = webflag.AddFlags(kingpin.CommandLine, ":9494")
 		dispatcherMap = kingpin.Flag(
 			"collector.dispatcher.mapping",
 			`Map a Dispatcher ID to a Name using the "ID:NAME" format. E.g. "100:Genesys"`,
 		).Default("").Strings()
 		collectorConfig = AddFlags(kingpin.CommandLine)
+		prewarm         = kingpin.Flag(
+			"kamailio.prewarm",
+			"Connect to Kamailio and run system.listMethods at startup, so the first scrape doesn't wait for the connection.",
+		).Default("false").Bool()
+		strictStartup = kingpin.Flag(
+			"kamailio.strict-startup",
+			"Exit when the --kamailio.prewarm connection fails, instead of logging it.",
+		).Default("false").Bool()
+		diffAgainst = kingpin.Flag(
+			"diff-against",
+			"Scrape once, print the series added and removed since this snapshot file, and exit with 1 if they changed. The values and label values aren't compared.",
+		).Default("").String()
+		diffUpdate = kingpin.Flag(
+			"diff-update",
+			"Write the series of one scrape to the --diff-against snapshot file, and exit.",
+		).Default("false").Bool()
+		_ = kingpin.Flag(
+			"config.file",
+			"YAML file setting the flags, by name. The command line overrides it.",
+		).Default("").String()
 	)
 
 	promlogConfig := &promlog.Config{}
 	flag.AddFlags(kingpin.CommandLine, promlogConfig)
 	kingpin.Version(version.Print("kamailio_exporter"))
+	// the file sets the defaults, it must be loaded before parsing the command line
+	if path := configFileFlag(os.Args[1:]); path != "" {
+		if err := loadConfigFile(kingpin.CommandLine, path); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 	kingpin.Parse()
 	logger := promlog.New(promlogConfig)
 
@@ -95,7 +191,21 @@ func main() {
 		panic(err)
 	}
 
-	prometheus.MustRegister(c)
+	if *diffAgainst != "" {
+		code := runDiff(c, *diffAgainst, *diffUpdate)
+		c.Close()
+		os.Exit(code)
+	}
+
+	if *prewarm {
+		if err := c.Prewarm(); err != nil {
+			if *strictStartup {
+				level.Error(logger).Log("msg", "Can not connect to kamailio at startup", "err", err)
+				os.Exit(1)
+			}
+			level.Warn(logger).Log("msg", "Can not connect to kamailio at startup", "err", err)
+		}
+	}
 
 	if *metricsPath != "/" && *metricsPath != "" {
 		landingConfig := web.LandingConfig{
@@ -117,9 +227,14 @@ func main() {
 		http.Handle("/", landingPage)
 	}
 	if *rtpmetricsPath != "" {
-		level.Info(logger).Log("msg", "Enabling rtp metrics", "path", rtpmetricsPath)
+		level.Info(logger).Log("msg", "Enabling rtp metrics", "path", rtpmetricsPath, "url", *rtpengineMetricsURL)
+		rtpClient, rtpURL, err := newRTPEngineClient(*rtpengineMetricsURL, *rtpengineTimeout)
+		if err != nil {
+			level.Error(logger).Log("msg", "Invalid rtpengine metrics URL", "err", err)
+			os.Exit(1)
+		}
 		http.HandleFunc(*rtpmetricsPath, func(w http.ResponseWriter, r *http.Request) {
-			resp, err := http.Get("http://127.0.0.1:9901/metrics")
+			resp, err := rtpClient.Get(rtpURL)
 			if err != nil {
 				level.Warn(logger).Log("err", err)
 				http.Error(w,
@@ -143,21 +258,85 @@ func main() {
 		})
 	}
 
-	if *customMetricsURL != "" {
-		http.Handle(*metricsPath, handlerWithUserDefinedMetrics(*customMetricsURL, logger))
-	} else {
-		http.Handle(*metricsPath, promhttp.Handler())
+	if *probePath != "" {
+		level.Info(logger).Log("msg", "Enabling probes", "path", *probePath)
+		http.HandleFunc(*probePath, func(w http.ResponseWriter, r *http.Request) {
+			target := r.URL.Query().Get("target")
+			if socket := r.URL.Query().Get("socket"); socket != "" {
+				target = "unix://" + socket
+			}
+			if target == "" {
+				http.Error(w, "target or socket parameter is missing", http.StatusBadRequest)
+				return
+			}
+			probe, err := c.WithTimeout(scrapeTimeout(r)).ProbeCollector(target)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(probe)
+			promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+		})
+	}
+
+	started := time.Now()
+	http.HandleFunc("/-/health", func(w http.ResponseWriter, r *http.Request) {
+		health := collector.Health()
+		w.Header().Set("Content-Type", "application/json")
+		// Kamailio may still be starting along with the exporter
+		if !health.Up && time.Since(started) < *startupGracePeriod {
+			health.Starting = true
+		} else if !health.Up {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(health); err != nil {
+			level.Warn(logger).Log("msg", "Error writing response", "err", err)
+		}
+	})
+
+	http.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	http.Handle("/ready", readyHandler(c, started, *startupGracePeriod, logger))
+
+	metricsHandler := handlerWithKamailioMetrics(c, *customMetricsURL, *customMetricsAccept, logger)
+	if *warningsHeader {
+		metricsHandler = handlerWithWarningsHeader(metricsHandler)
 	}
+	http.Handle(*metricsPath, metricsHandler)
 	server := &http.Server{}
-	if err := web.ListenAndServe(server, toolkitFlags, logger); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- web.ListenAndServe(server, toolkitFlags, logger)
+	}()
+	select {
+	case err := <-serverErr:
 		level.Info(logger).Log("err", err)
 		os.Exit(1)
+	case <-ctx.Done():
+	}
+
+	// let the running scrapes finish
+	level.Info(logger).Log("msg", "Shutting down", "grace_period", *gracePeriod)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), *gracePeriod)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		level.Warn(logger).Log("msg", "Scrapes still running at shutdown", "err", err)
 	}
+	c.Close()
 }
 
 // Request user defined metrics and parse them into proper data objects
-func gatherUserDefinedMetrics(url string, logger log.Logger) ([]*dto.MetricFamily, error) {
-	resp, err := http.Get(url)
+func gatherUserDefinedMetrics(url string, accept string, logger log.Logger) ([]*dto.MetricFamily, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		level.Error(logger).Log("msg", "Failed to query kamailio user defined metrics", "err", err)
 		return nil, err
@@ -177,7 +356,12 @@ func gatherUserDefinedMetrics(url string, logger log.Logger) ([]*dto.MetricFamil
 	parser := expfmt.TextParser{}
 	parsed, err := parser.TextToMetricFamilies(bytes.NewReader(respBytes))
 	if err != nil {
-		return nil, err
+		// retry as OpenMetrics, in case the endpoint negotiated it
+		parser = expfmt.TextParser{}
+		parsed, err = parser.TextToMetricFamilies(bytes.NewReader(openMetricsToText(respBytes)))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	result := []*dto.MetricFamily{}
@@ -188,22 +372,167 @@ func gatherUserDefinedMetrics(url string, logger log.Logger) ([]*dto.MetricFamil
 	return result, nil
 }
 
-func handlerWithUserDefinedMetrics(userDefinedMetricsURL string, logger log.Logger) http.Handler {
-	gatherer := func() ([]*dto.MetricFamily, error) {
-		ours, err := prometheus.DefaultGatherer.Gather()
+// newRTPEngineClient returns the client and URL to request the rtpengine
+// metrics. An "http+unix" URL has the socket path escaped as host, e.g.
+// "http+unix://%2Fvar%2Frun%2Frtpengine.sock/metrics".
+func newRTPEngineClient(metricsURL string, timeout time.Duration) (*http.Client, string, error) {
+	client := &http.Client{Timeout: timeout}
+	if !strings.HasPrefix(metricsURL, "http+unix://") {
+		return client, metricsURL, nil
+	}
+	// net/url doesn't accept an escaped path as host
+	host, path, _ := strings.Cut(strings.TrimPrefix(metricsURL, "http+unix://"), "/")
+	socket, err := url.PathUnescape(host)
+	if err != nil {
+		return nil, "", err
+	}
+	if socket == "" {
+		return nil, "", fmt.Errorf("missing socket path in %q", metricsURL)
+	}
+	client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		},
+	}
+	return client, "http://rtpengine/" + path, nil
+}
+
+// add the user defined metrics to the metrics of the gatherer
+func withUserDefinedMetrics(g prometheus.Gatherer, userDefinedMetricsURL string, accept string, logger log.Logger) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		ours, err := g.Gather()
 		if err != nil {
 			return ours, err
 		}
-		theirs, err := gatherUserDefinedMetrics(userDefinedMetricsURL, logger)
+		theirs, err := gatherUserDefinedMetrics(userDefinedMetricsURL, accept, logger)
 		if err != nil {
 			level.Error(logger).Log("msg", "Scraping user defined metrics failed", "err", err)
 			return ours, nil
 		}
 		return append(ours, theirs...), nil
+	})
+}
+
+// margin left to send the response before Prometheus gives up the scrape
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+// scrapeTimeout returns the timeout sent by Prometheus, minus the offset.
+// 0 means there is none.
+func scrapeTimeout(r *http.Request) time.Duration {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil {
+		return 0
 	}
+	timeout := time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset
+	if timeout <= 0 {
+		return 0
+	}
+	return timeout
+}
 
+// Accept header selecting the delimited protobuf exposition format
+const protobufAccept = "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited"
+
+// The Kamailio collector is registered for each request, so its timeout
+// follows the scrape timeout of Prometheus.
+func handlerWithKamailioMetrics(c *collector.KamailioCollector, userDefinedMetricsURL string, accept string, logger log.Logger) http.Handler {
 	// defaults like promhttp.Handler(), except using our own gatherer
 	return promhttp.InstrumentMetricHandler(
 		prometheus.DefaultRegisterer,
-		promhttp.HandlerFor(prometheus.GathererFunc(gatherer), promhttp.HandlerOpts{}))
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// let clients without content negotiation ask for protobuf
+			if r.URL.Query().Get("format") == "protobuf" {
+				r.Header.Set("Accept", protobufAccept)
+			}
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(c.WithTimeout(scrapeTimeout(r)))
+			var gatherer prometheus.Gatherer = prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+			if userDefinedMetricsURL != "" {
+				gatherer = withUserDefinedMetrics(gatherer, userDefinedMetricsURL, accept, logger)
+			}
+			promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+		}))
+}
+
+// maximum length of the X-Kamailio-Exporter-Warnings header value
+const maxWarningsHeaderLength = 1024
+
+// warningsResponseWriter adds the warnings header once the metrics are gathered,
+// right before the response is written.
+type warningsResponseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *warningsResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if warnings := collector.Health().Warnings(); len(warnings) > 0 {
+			w.Header().Set("X-Kamailio-Exporter-Warnings", formatWarnings(warnings))
+		}
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *warningsResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// join the warnings, truncating the list when it gets too long
+func formatWarnings(warnings []string) string {
+	value := strings.Join(warnings, ",")
+	if len(value) <= maxWarningsHeaderLength {
+		return value
+	}
+	value = value[:maxWarningsHeaderLength]
+	if i := strings.LastIndex(value, ","); i > 0 {
+		value = value[:i]
+	}
+	return value + ",..."
+}
+
+func handlerWithWarningsHeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&warningsResponseWriter{ResponseWriter: w}, r)
+	})
+}
+
+// how long /ready answers with the result of the previous ping
+const readyCacheTTL = 2 * time.Second
+
+// readyHandler answers 200 when Kamailio answers a ping, 503 otherwise, or
+// 200 with "starting" during the grace period after the start. The result is
+// cached, so frequent probes don't load the ctl process.
+func readyHandler(c *collector.KamailioCollector, started time.Time, gracePeriod time.Duration, logger log.Logger) http.Handler {
+	var (
+		mtx     sync.Mutex
+		checked time.Time
+		lastErr error
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		if time.Since(checked) >= readyCacheTTL {
+			lastErr = c.Ping()
+			checked = time.Now()
+			if lastErr != nil {
+				level.Debug(logger).Log("msg", "Kamailio is not ready", "err", lastErr)
+			}
+		}
+		err := lastErr
+		mtx.Unlock()
+		// Kamailio may still be starting along with the exporter
+		if err != nil && time.Since(started) < gracePeriod {
+			fmt.Fprintln(w, "starting")
+			return
+		}
+		if err != nil {
+			http.Error(w, "kamailio unreachable: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
 }
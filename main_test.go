@@ -0,0 +1,121 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/angarium-cloud/kamailio_exporter/collector"
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// newUnreachableCollector returns a collector whose Kamailio never answers.
+func newUnreachableCollector(t *testing.T) *collector.KamailioCollector {
+	uri := "unix:///nonexistent/kamailio_ctl"
+	c, err := collector.NewKamailioCollector(&collector.KamailioCollectorConfig{BinrpcURI: &uri}, log.NewNopLogger())
+	if err != nil {
+		t.Fatalf("NewKamailioCollector: %v", err)
+	}
+	return c
+}
+
+func TestReadyGracePeriod(t *testing.T) {
+	c := newUnreachableCollector(t)
+	tests := []struct {
+		gracePeriod time.Duration
+		code        int
+		body        string
+	}{
+		{time.Hour, http.StatusOK, "starting"},
+		{0, http.StatusServiceUnavailable, "kamailio unreachable"},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		readyHandler(c, time.Now(), test.gracePeriod, log.NewNopLogger()).ServeHTTP(rec, httptest.NewRequest("GET", "/ready", nil))
+		if rec.Code != test.code || !strings.Contains(rec.Body.String(), test.body) {
+			t.Errorf("grace period %s: got %d %q, want %d %q", test.gracePeriod, rec.Code, rec.Body.String(), test.code, test.body)
+		}
+	}
+}
+
+// decodeFamilies returns the names of the metric families of a response.
+func decodeFamilies(t *testing.T, rec *httptest.ResponseRecorder) map[string]bool {
+	// Decode wraps the reader in a new bufio.Reader unless it already is one
+	decoder := expfmt.NewDecoder(bufio.NewReader(rec.Body), expfmt.ResponseFormat(rec.Header()))
+	names := map[string]bool{}
+	for {
+		var family dto.MetricFamily
+		err := decoder.Decode(&family)
+		if errors.Is(err, io.EOF) {
+			return names
+		}
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		names[family.GetName()] = true
+	}
+}
+
+func TestMetricsProtobuf(t *testing.T) {
+	custom := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		io.WriteString(w, "# TYPE custom_total counter\ncustom_total 42\n")
+	}))
+	defer custom.Close()
+	handler := handlerWithKamailioMetrics(newUnreachableCollector(t), custom.URL, "text/plain", log.NewNopLogger())
+
+	tests := []struct {
+		name   string
+		target string
+		accept string
+	}{
+		{"accept header", "/metrics", protobufAccept},
+		{"format parameter", "/metrics?format=protobuf", ""},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.target, nil)
+		if test.accept != "" {
+			req.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if contentType := rec.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/vnd.google.protobuf") {
+			t.Errorf("%s: got content type %q, want protobuf", test.name, contentType)
+			continue
+		}
+		names := decodeFamilies(t, rec)
+		for _, name := range []string{"kamailio_up", "custom_total"} {
+			if !names[name] {
+				t.Errorf("%s: missing family %s in %v", test.name, name, names)
+			}
+		}
+	}
+}
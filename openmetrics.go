@@ -0,0 +1,146 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Convert the OpenMetrics text format to the Prometheus text format, which
+// the expfmt parser reads:
+//   - the counters are named with their _total suffix, and the info metrics
+//     with their _info suffix, like their samples,
+//   - the _created samples, the exemplars and the UNIT and EOF lines are dropped,
+//   - the timestamps are converted from seconds to milliseconds,
+//   - the info and stateset metrics become gauges, the gauge histograms
+//     histograms, the unknown ones untyped.
+func openMetricsToText(in []byte) []byte {
+	var out bytes.Buffer
+	family, familyType := "", ""
+	for _, line := range strings.Split(string(in), "\n") {
+		switch {
+		case line == "# EOF", strings.HasPrefix(line, "# UNIT "):
+			continue
+		case strings.HasPrefix(line, "# TYPE "):
+			fields := strings.Fields(line)
+			if len(fields) != 4 {
+				break
+			}
+			family, familyType = fields[2], fields[3]
+			line = "# TYPE " + textFamilyName(family, familyType) + " " + textFamilyType(familyType)
+		case strings.HasPrefix(line, "# HELP "):
+			fields := strings.SplitN(line, " ", 4)
+			if len(fields) < 3 {
+				break
+			}
+			// the HELP line may come before the TYPE one
+			if fields[2] != family {
+				family, familyType = fields[2], ""
+			}
+			fields[2] = textFamilyName(family, familyType)
+			line = strings.Join(fields, " ")
+		case strings.HasPrefix(line, "#"), line == "":
+		default:
+			var ok bool
+			line, ok = openMetricsSample(line, family, familyType)
+			if !ok {
+				continue
+			}
+		}
+		out.WriteString(line)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// textFamilyName returns the name of a family in the text format, i.e. the
+// name of its samples.
+func textFamilyName(name string, familyType string) string {
+	switch {
+	case familyType == "counter" && !strings.HasSuffix(name, "_total"):
+		return name + "_total"
+	case familyType == "info" && !strings.HasSuffix(name, "_info"):
+		return name + "_info"
+	}
+	return name
+}
+
+func textFamilyType(familyType string) string {
+	switch familyType {
+	case "info", "stateset":
+		return "gauge"
+	case "gaugehistogram":
+		return "histogram"
+	case "unknown":
+		return "untyped"
+	}
+	return familyType
+}
+
+// openMetricsSample converts a sample line, it returns false for the samples
+// the text format doesn't have.
+func openMetricsSample(line string, family string, familyType string) (string, bool) {
+	nameEnd := strings.IndexAny(line, "{ ")
+	if nameEnd < 0 {
+		return line, true
+	}
+	name, labels, rest := line[:nameEnd], "", line[nameEnd:]
+	if line[nameEnd] == '{' {
+		// the label values may have spaces, braces and # in them
+		quoted := false
+		for i := nameEnd + 1; i < len(line); i++ {
+			if quoted && line[i] == '\\' {
+				i++
+			} else if line[i] == '"' {
+				quoted = !quoted
+			} else if line[i] == '}' && !quoted {
+				labels, rest = line[nameEnd:i+1], line[i+1:]
+				break
+			}
+		}
+	}
+	if name == family+"_created" {
+		return "", false
+	}
+	if familyType == "gaugehistogram" {
+		switch name {
+		case family + "_gcount":
+			name = family + "_count"
+		case family + "_gsum":
+			name = family + "_sum"
+		}
+	}
+	// drop the exemplar
+	if i := strings.Index(rest, " # "); i >= 0 {
+		rest = rest[:i]
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 2 {
+		if seconds, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			fields[1] = strconv.FormatInt(int64(math.Round(seconds*1000)), 10)
+		}
+	}
+	return name + labels + " " + strings.Join(fields, " "), true
+}
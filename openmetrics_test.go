@@ -0,0 +1,159 @@
+// MIT License
+
+// Copyright (c) 2023 Yann Vigara, Angarium Limited
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-kit/log"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const openMetricsBody = `# TYPE kamailio_calls counter
+# HELP kamailio_calls Calls handled by the script.
+# UNIT kamailio_calls calls
+kamailio_calls_total{route="main"} 17 # {trace_id="abc"} 1 1700000000.5
+kamailio_calls_created{route="main"} 1700000000.25
+# TYPE kamailio_build info
+kamailio_build_info{version="5.7.4",note="a } # b"} 1
+# TYPE kamailio_mode stateset
+kamailio_mode{kamailio_mode="active"} 1
+kamailio_mode{kamailio_mode="standby"} 0
+# TYPE kamailio_queue gaugehistogram
+kamailio_queue_bucket{le="1.0"} 2
+kamailio_queue_bucket{le="+Inf"} 3
+kamailio_queue_gcount 3
+kamailio_queue_gsum 4.5
+# TYPE kamailio_temperature unknown
+kamailio_temperature 21.5 1700000000.5
+# EOF
+`
+
+func TestGatherUserDefinedMetrics(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        string
+		families    map[string]dto.MetricType
+	}{
+		{
+			"application/openmetrics-text; version=1.0.0; charset=utf-8",
+			openMetricsBody,
+			map[string]dto.MetricType{
+				"kamailio_calls_total": dto.MetricType_COUNTER,
+				"kamailio_build_info":  dto.MetricType_GAUGE,
+				"kamailio_mode":        dto.MetricType_GAUGE,
+				"kamailio_queue":       dto.MetricType_HISTOGRAM,
+				"kamailio_temperature": dto.MetricType_UNTYPED,
+			},
+		},
+		{
+			"text/plain; version=0.0.4",
+			"# TYPE kamailio_calls_total counter\nkamailio_calls_total 17\n",
+			map[string]dto.MetricType{"kamailio_calls_total": dto.MetricType_COUNTER},
+		},
+	}
+	for _, test := range tests {
+		var accept string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accept = r.Header.Get("Accept")
+			w.Header().Set("Content-Type", test.contentType)
+			w.Write([]byte(test.body))
+		}))
+		families, err := gatherUserDefinedMetrics(server.URL, "application/openmetrics-text", log.NewNopLogger())
+		server.Close()
+		if err != nil {
+			t.Errorf("%s: %v", test.contentType, err)
+			continue
+		}
+		if accept != "application/openmetrics-text" {
+			t.Errorf("%s: Accept header = %q", test.contentType, accept)
+		}
+		got := make(map[string]*dto.MetricFamily)
+		for _, family := range families {
+			got[family.GetName()] = family
+		}
+		if len(got) != len(test.families) {
+			t.Errorf("%s: got %d families, want %d", test.contentType, len(got), len(test.families))
+		}
+		for name, metricType := range test.families {
+			family, ok := got[name]
+			if !ok {
+				t.Errorf("%s: family %s is missing", test.contentType, name)
+				continue
+			}
+			if family.GetType() != metricType {
+				t.Errorf("%s: family %s is a %v, want a %v", test.contentType, name, family.GetType(), metricType)
+			}
+		}
+	}
+}
+
+func TestOpenMetricsToTextSamples(t *testing.T) {
+	families, err := gatherOpenMetrics(t, openMetricsBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := families["kamailio_calls_total"].GetMetric()
+	if len(calls) != 1 || calls[0].GetCounter().GetValue() != 17 {
+		t.Errorf("kamailio_calls_total = %v, want a single sample of 17", calls)
+	}
+	build := families["kamailio_build_info"].GetMetric()
+	note := ""
+	for _, metric := range build {
+		for _, label := range metric.GetLabel() {
+			if label.GetName() == "note" {
+				note = label.GetValue()
+			}
+		}
+	}
+	if len(build) != 1 || note != "a } # b" {
+		t.Errorf("kamailio_build_info = %v, want the note label kept", build)
+	}
+	queue := families["kamailio_queue"].GetMetric()
+	if len(queue) != 1 || queue[0].GetHistogram().GetSampleCount() != 3 || queue[0].GetHistogram().GetSampleSum() != 4.5 {
+		t.Errorf("kamailio_queue = %v, want a count of 3 and a sum of 4.5", queue)
+	}
+	temperature := families["kamailio_temperature"].GetMetric()
+	if len(temperature) != 1 || temperature[0].GetTimestampMs() != 1700000000500 {
+		t.Errorf("kamailio_temperature = %v, want a timestamp of 1700000000500", temperature)
+	}
+}
+
+// gatherOpenMetrics serves body as OpenMetrics and gathers it.
+func gatherOpenMetrics(t *testing.T, body string) (map[string]*dto.MetricFamily, error) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+	families, err := gatherUserDefinedMetrics(server.URL, "application/openmetrics-text", log.NewNopLogger())
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*dto.MetricFamily)
+	for _, family := range families {
+		byName[family.GetName()] = family
+	}
+	return byName, nil
+}